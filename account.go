@@ -0,0 +1,389 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerDeleteMe schedules the authenticated user for deletion. The
+// account is hidden and signed out right away, but only purged once the
+// grace period is over. Logging in before then cancels the deletion.
+func (cfg *apiConfig) handlerDeleteMe(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+	}
+	type response struct {
+		DeletedAt time.Time `json:"deleted_at"`
+		PurgeAt   time.Time `json:"purge_at"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	_, span := tracer.Start(r.Context(), "auth.CheckPasswordHash")
+	err = auth.CheckPasswordHash(params.CurrentPassword, user.HashedPassword)
+	span.End()
+	if err != nil {
+		respondError(w, r, http.StatusForbidden, codeInvalidCredentials, "current password is incorrect", err)
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete user", err)
+		return
+	}
+	defer tx.Rollback()
+
+	user, err = qtx.ScheduleUserDeletion(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete user", err)
+		return
+	}
+	if _, err := qtx.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete user", err)
+		return
+	}
+	if err := qtx.DeleteUserEmailChanges(r.Context(), user.ID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete user", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, response{
+		DeletedAt: user.DeletedAt.Time,
+		PurgeAt:   user.DeletedAt.Time.Add(cfg.deletionGrace),
+	})
+}
+
+// runAccountPurge hard deletes users whose deletion grace period is over.
+// Everything they own goes with them through the foreign keys, only media
+// files need removing by hand.
+func (cfg *apiConfig) runAccountPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-cfg.deletionGrace)
+		users, err := cfg.db.PurgeDeletedUsers(ctx, sql.NullTime{Time: cutoff, Valid: true})
+		if err != nil {
+			slog.Error("failed to purge deleted users", "error", err)
+		} else if len(users) > 0 {
+			for _, user := range users {
+				cfg.removeMedia(user.AvatarPath)
+			}
+			slog.Info("purged deleted users", "count", len(users))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type exportChirp struct {
+	Chirp
+	HiddenAt  *time.Time `json:"hidden_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type exportFollow struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+	Since  time.Time `json:"since"`
+}
+
+type exportSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type exportSubscription struct {
+	Plan               string     `json:"plan"`
+	Status             string     `json:"status"`
+	CurrentPeriodStart time.Time  `json:"current_period_start"`
+	CurrentPeriodEnd   *time.Time `json:"current_period_end,omitempty"`
+}
+
+type exportSubscriptionEvent struct {
+	CreatedAt   time.Time  `json:"created_at"`
+	Event       string     `json:"event"`
+	Plan        string     `json:"plan"`
+	Status      string     `json:"status"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+}
+
+// exportFiles are the files of the data export, in archive order.
+var exportFiles = []string{
+	"profile.json",
+	"chirps.json",
+	"scheduled_chirps.json",
+	"drafts.json",
+	"following.json",
+	"followers.json",
+	"blocks.json",
+	"mutes.json",
+	"reports.json",
+	"webhooks.json",
+	"sessions.json",
+	"subscription.json",
+	"subscription_history.json",
+}
+
+// handlerExportMe sends a zip archive of everything stored about the
+// authenticated user. Refresh tokens are listed as sessions without the
+// token values and webhook endpoints without their signing secrets, those
+// are credentials rather than data.
+func (cfg *apiConfig) handlerExportMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	// Everything is loaded before the archive is written, once the first
+	// byte is out an error can no longer be reported
+	files := map[string]any{"profile.json": newUser(user)}
+
+	// Deleted chirps are kept until purged, so they are exported too
+	chirps, err := cfg.db.GetUserChirpsIncludingDeleted(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export chirps", err)
+		return
+	}
+	jsonChirps := make([]exportChirp, len(chirps))
+	for i, chirp := range chirps {
+		jsonChirps[i] = exportChirp{
+			Chirp:     newChirp(chirp),
+			HiddenAt:  timePtr(chirp.HiddenAt),
+			DeletedAt: timePtr(chirp.DeletedAt),
+		}
+	}
+	files["chirps.json"] = jsonChirps
+
+	scheduled, err := cfg.db.GetUserScheduledChirps(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export scheduled chirps", err)
+		return
+	}
+	jsonScheduled := make([]ScheduledChirp, len(scheduled))
+	for i, s := range scheduled {
+		jsonScheduled[i] = newScheduledChirp(s)
+	}
+	files["scheduled_chirps.json"] = jsonScheduled
+
+	drafts, err := cfg.db.GetUserDrafts(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export drafts", err)
+		return
+	}
+	jsonDrafts := make([]Draft, len(drafts))
+	for i, draft := range drafts {
+		jsonDrafts[i] = newDraft(draft)
+	}
+	files["drafts.json"] = jsonDrafts
+
+	following, err := cfg.db.GetFollowing(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export follows", err)
+		return
+	}
+	jsonFollowing := make([]exportFollow, len(following))
+	for i, follow := range following {
+		jsonFollowing[i] = exportFollow{UserID: follow.ID, Handle: follow.Handle, Since: follow.CreatedAt}
+	}
+	files["following.json"] = jsonFollowing
+
+	followers, err := cfg.db.GetFollowers(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export followers", err)
+		return
+	}
+	jsonFollowers := make([]exportFollow, len(followers))
+	for i, follow := range followers {
+		jsonFollowers[i] = exportFollow{UserID: follow.ID, Handle: follow.Handle, Since: follow.CreatedAt}
+	}
+	files["followers.json"] = jsonFollowers
+
+	blocked, err := cfg.db.GetBlockedUsers(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export blocks", err)
+		return
+	}
+	files["blocks.json"] = newUserSummaries(blocked)
+
+	muted, err := cfg.db.GetMutedUsers(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export mutes", err)
+		return
+	}
+	files["mutes.json"] = newUserSummaries(muted)
+
+	reports, err := cfg.db.GetUserReports(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export reports", err)
+		return
+	}
+	jsonReports := make([]Report, len(reports))
+	for i, report := range reports {
+		jsonReports[i] = newReport(report)
+	}
+	files["reports.json"] = jsonReports
+
+	endpoints, err := cfg.db.GetUserWebhookEndpoints(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export webhooks", err)
+		return
+	}
+	jsonEndpoints := make([]WebhookEndpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		jsonEndpoints[i] = newWebhookEndpoint(endpoint)
+	}
+	files["webhooks.json"] = jsonEndpoints
+
+	tokens, err := cfg.db.GetUserRefreshTokens(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export sessions", err)
+		return
+	}
+	sessions := make([]exportSession, len(tokens))
+	for i, token := range tokens {
+		sessions[i] = exportSession{
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			RevokedAt: timePtr(token.RevokedAt),
+		}
+	}
+	files["sessions.json"] = sessions
+
+	subscription, err := cfg.db.GetSubscriptionByUser(r.Context(), user.ID)
+	if err == nil {
+		files["subscription.json"] = exportSubscription{
+			Plan:               subscription.Plan,
+			Status:             subscription.Status,
+			CurrentPeriodStart: subscription.CurrentPeriodStart,
+			CurrentPeriodEnd:   timePtr(subscription.CurrentPeriodEnd),
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export subscription", err)
+		return
+	}
+
+	history, err := cfg.db.GetUserSubscriptionHistory(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export subscription history", err)
+		return
+	}
+	events := make([]exportSubscriptionEvent, len(history))
+	for i, event := range history {
+		events[i] = exportSubscriptionEvent{
+			CreatedAt:   event.CreatedAt,
+			Event:       event.Event,
+			Plan:        event.Plan,
+			Status:      event.Status,
+			PeriodStart: event.PeriodStart,
+			PeriodEnd:   timePtr(event.PeriodEnd),
+		}
+	}
+	files["subscription_history.json"] = events
+
+	var avatar []byte
+	if user.AvatarPath.Valid {
+		avatar, err = os.ReadFile(filepath.Join(cfg.mediaDir, filepath.FromSlash(user.AvatarPath.String)))
+		// The rest of the export is still worth having without the avatar
+		if errors.Is(err, fs.ErrNotExist) {
+			loggerFrom(r.Context()).Warn("avatar missing from export", "path", user.AvatarPath.String)
+		} else if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to export avatar", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-%s-%s.zip"`, user.Handle, time.Now().UTC().Format("20060102")))
+
+	archive := zip.NewWriter(w)
+	for _, name := range exportFiles {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		if err := writeJSONFile(archive, name, data); err != nil {
+			loggerFrom(r.Context()).Error("failed to write export", "file", name, "error", err)
+			return
+		}
+	}
+	if avatar != nil {
+		f, err := archive.Create(path.Join("media", path.Base(user.AvatarPath.String)))
+		if err == nil {
+			_, err = f.Write(avatar)
+		}
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to write export", "file", "avatar", "error", err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		loggerFrom(r.Context()).Error("failed to write export", "error", err)
+	}
+}
+
+// timePtr returns the time of a nullable column, or nil for NULL.
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func writeJSONFile(archive *zip.Writer, name string, data any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	userStatusActive    = "active"
+	userStatusSuspended = "suspended"
+	userStatusBanned    = "banned"
+)
+
+var (
+	errAccountLookup  = errors.New("failed to look up account")
+	errAccountDeleted = errors.New("account is scheduled for deletion")
+)
+
+// accountRestriction explains why an account can't be used. It is sent
+// as the account member of the error response.
+type accountRestriction struct {
+	Status string     `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+func (a *accountRestriction) Error() string {
+	return "account is " + a.Status
+}
+
+// restriction returns why user can't use their account at now, or nil if
+// they can. A suspension ends by itself once its time is up.
+func restriction(user database.User, now time.Time) *accountRestriction {
+	switch user.Status {
+	case userStatusBanned:
+		return &accountRestriction{Status: user.Status, Reason: user.StatusReason}
+	case userStatusSuspended:
+		if user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(now) {
+			return &accountRestriction{
+				Status: user.Status,
+				Reason: user.StatusReason,
+				Until:  &user.SuspendedUntil.Time,
+			}
+		}
+	}
+	return nil
+}
+
+func respondAccountRestricted(w http.ResponseWriter, r *http.Request, restricted *accountRestriction) {
+	p := problem{
+		Status:  http.StatusForbidden,
+		Code:    codeAccountBanned,
+		Detail:  "account has been banned",
+		Account: restricted,
+	}
+	if restricted.Status == userStatusSuspended {
+		p.Code = codeAccountSuspended
+		p.Detail = "account is suspended until " + restricted.Until.UTC().Format(time.RFC3339)
+	}
+	if restricted.Reason != "" {
+		p.Detail += ": " + restricted.Reason
+	}
+	writeProblem(w, r, p, nil)
+}
+
+// respondAuthError sends the response for an error from authenticate.
+func respondAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var restricted *accountRestriction
+	switch {
+	case errors.As(err, &restricted):
+		respondAccountRestricted(w, r, restricted)
+	case errors.Is(err, errAccountLookup):
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to authenticate", err)
+	default:
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing or invalid access token", err)
+	}
+}
+
+// checkAccount returns an error if the user's account can't be used,
+// either because it is gone, scheduled for deletion or restricted. A user
+// who deleted their account is signed out, logging in again is the only
+// way to cancel the deletion.
+func (cfg *apiConfig) checkAccount(ctx context.Context, userID uuid.UUID) error {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errAccountLookup, err)
+	}
+	if user.DeletedAt.Valid {
+		return errAccountDeleted
+	}
+
+	if restricted := restriction(user, time.Now()); restricted != nil {
+		return restricted
+	}
+	return nil
+}
+
+// setAccountStatus moves a user to status. Restricting an account also
+// revokes the user's refresh tokens, access tokens are refused by
+// authenticate. until is only used for suspensions.
+func setAccountStatus(ctx context.Context, q *database.Queries, userID uuid.UUID, status string, until time.Time, reason string) (database.User, int64, error) {
+	params := database.SetUserStatusParams{
+		ID:     userID,
+		Status: status,
+	}
+	if status == userStatusSuspended {
+		params.SuspendedUntil = sql.NullTime{Time: until, Valid: true}
+	}
+	if status != userStatusActive {
+		params.StatusReason = reason
+	}
+
+	user, err := q.SetUserStatus(ctx, params)
+	if err != nil {
+		return database.User{}, 0, err
+	}
+
+	var revoked int64
+	if status != userStatusActive {
+		revoked, err = q.RevokeUserRefreshTokens(ctx, userID)
+		if err != nil {
+			return database.User{}, 0, err
+		}
+	}
+	return user, revoked, nil
+}
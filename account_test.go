@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Quak1/chirpy/internal/database"
+)
+
+func TestDeleteMe(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	leaving := createTestUser(t, cfg, "leaving")
+	viewer := createTestUser(t, cfg, "viewer")
+
+	chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "goodbye", UserID: leaving.ID})
+	if err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+
+	r := newTestRequest(t, "DELETE", "/api/users/me", &leaving, map[string]any{"current_password": "wrong"})
+	serveTest(t, cfg.handlerDeleteMe, r, http.StatusForbidden, nil)
+
+	r = newTestRequest(t, "DELETE", "/api/users/me", &leaving, map[string]any{"current_password": testPassword})
+	serveTest(t, cfg.handlerDeleteMe, r, http.StatusAccepted, nil)
+
+	var chirps []Chirp
+	r = newTestRequest(t, "GET", "/api/chirps", &viewer, nil)
+	serveTest(t, cfg.handlerGetAllChirps, r, http.StatusOK, &chirps)
+	if len(chirps) != 0 {
+		t.Errorf("expected no chirps, got %d", len(chirps))
+	}
+
+	r = newTestRequest(t, "GET", "/api/chirps/"+chirp.ID.String(), &viewer, nil, "chirpID", chirp.ID.String())
+	serveTest(t, cfg.handlerGetChirp, r, http.StatusNotFound, nil)
+
+	r = newTestRequest(t, "GET", "/api/users/leaving", &viewer, nil, "handle", "leaving")
+	serveTest(t, cfg.handlerGetProfile, r, http.StatusNotFound, nil)
+
+	// Deleting signs the user out everywhere
+	r = newTestRequest(t, "GET", "/api/drafts", &leaving, nil)
+	serveTest(t, cfg.handlerGetDrafts, r, http.StatusUnauthorized, nil)
+}
+
+func TestExportMe(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, cfg, "exporter")
+	if _, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "mine", UserID: user.ID}); err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+	_, err := cfg.db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		UserID: user.ID,
+		Url:    "https://example.com/hooks",
+		Secret: "whsec-do-not-export",
+		Events: []string{eventChirpCreated},
+	})
+	if err != nil {
+		t.Fatalf("failed to create webhook endpoint: %v", err)
+	}
+	// The avatar file is missing from the media directory
+	_, err = cfg.db.SetUserAvatar(ctx, database.SetUserAvatarParams{
+		ID:         user.ID,
+		AvatarPath: sql.NullString{String: "avatars/missing.png", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to set avatar: %v", err)
+	}
+
+	r := newTestRequest(t, "GET", "/api/users/me/export", &user, nil)
+	rec := serveTest(t, cfg.handlerExportMe, r, http.StatusOK, nil)
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("failed to open export: %v", err)
+	}
+
+	names := []string{}
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", f.Name, err)
+		}
+		if strings.Contains(string(data), "whsec-do-not-export") {
+			t.Errorf("%s contains the webhook secret", f.Name)
+		}
+		if f.Name == "chirps.json" && !strings.Contains(string(data), "mine") {
+			t.Errorf("chirps.json is missing the chirp: %s", data)
+		}
+		if f.Name == "webhooks.json" && !strings.Contains(string(data), "https://example.com/hooks") {
+			t.Errorf("webhooks.json is missing the endpoint: %s", data)
+		}
+	}
+
+	for _, name := range []string{"profile.json", "chirps.json", "webhooks.json", "sessions.json"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected %s in the export, got %v", name, names)
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "media/") {
+			t.Errorf("expected no avatar in the export, got %s", name)
+		}
+	}
+}
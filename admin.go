@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/auth"
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// The admin commands reuse the handlers' building blocks so that, for
+// example, deleting a chirp from the CLI still notifies webhooks and
+// stream subscribers.
+
+// runUserCommand implements "chirpy user create|promote|suspend|ban|reinstate|reset-password".
+// disable and enable are kept as aliases of ban and reinstate.
+func (cfg *apiConfig) runUserCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: chirpy user create|promote|suspend|ban|reinstate|reset-password [flags]")
+	}
+
+	flags := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "new password, read from stdin when empty")
+	admin := flags.Bool("admin", false, "create the user as an admin")
+	suspendFor := flags.Duration("for", 0, "how long to suspend the user for")
+	reason := flags.String("reason", "", "reason shown to the user when suspending or banning")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	switch args[0] {
+	case "create":
+		hash, err := hashPasswordArg(*password)
+		if err != nil {
+			return err
+		}
+
+		user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+			Email:          *email,
+			HashedPassword: hash,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create user: %w", err)
+		}
+
+		if *admin {
+			user, err = cfg.db.SetUserRole(ctx, database.SetUserRoleParams{
+				ID:   user.ID,
+				Role: roleAdmin,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't promote user: %w", err)
+			}
+		}
+
+		fmt.Printf("created %s user %s (%s)\n", user.Role, user.Email, user.ID)
+		return nil
+
+	case "promote":
+		user, err := cfg.db.GetUserByEmail(ctx, *email)
+		if err != nil {
+			return userLookupError(err)
+		}
+
+		user, err = cfg.db.SetUserRole(ctx, database.SetUserRoleParams{
+			ID:   user.ID,
+			Role: roleAdmin,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't promote user: %w", err)
+		}
+
+		fmt.Printf("promoted %s to admin\n", user.Email)
+		return nil
+
+	case "suspend":
+		if *suspendFor <= 0 {
+			return errors.New("-for is required to suspend a user")
+		}
+		return cfg.setUserStatus(ctx, *email, userStatusSuspended, time.Now().Add(*suspendFor), *reason)
+
+	case "ban", "disable":
+		return cfg.setUserStatus(ctx, *email, userStatusBanned, time.Time{}, *reason)
+
+	case "reinstate", "enable":
+		return cfg.setUserStatus(ctx, *email, userStatusActive, time.Time{}, "")
+
+	case "reset-password":
+		user, err := cfg.db.GetUserByEmail(ctx, *email)
+		if err != nil {
+			return userLookupError(err)
+		}
+
+		hash, err := hashPasswordArg(*password)
+		if err != nil {
+			return err
+		}
+
+		tx, qtx, err := cfg.beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := qtx.SetUserPassword(ctx, database.SetUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: hash,
+		}); err != nil {
+			return fmt.Errorf("couldn't reset password: %w", err)
+		}
+
+		// Whoever knew the old password may still hold a session
+		revoked, err := qtx.RevokeUserRefreshTokens(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("couldn't revoke refresh tokens: %w", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		fmt.Printf("reset password for %s, revoked %d refresh tokens\n", user.Email, revoked)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown user command %q", args[0])
+	}
+}
+
+// setUserStatus suspends, bans or reinstates an account and records it in
+// the moderation audit trail.
+func (cfg *apiConfig) setUserStatus(ctx context.Context, email, status string, until time.Time, reason string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	tx, qtx, err := cfg.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user, revoked, err := setAccountStatus(ctx, qtx, user.ID, status, until, reason)
+	if err != nil {
+		return fmt.Errorf("couldn't update user: %w", err)
+	}
+
+	action := map[string]string{
+		userStatusSuspended: actionSuspendUser,
+		userStatusBanned:    actionBanUser,
+		userStatusActive:    actionReinstateUser,
+	}[status]
+	if _, err := qtx.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		Action:       action,
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Reason:       reason,
+	}); err != nil {
+		return fmt.Errorf("couldn't record moderation action: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("set %s to %s, revoked %d refresh tokens\n", user.Email, status, revoked)
+	return nil
+}
+
+// runChirpCommand implements "chirpy chirp delete <id>".
+func (cfg *apiConfig) runChirpCommand(ctx context.Context, args []string) error {
+	if len(args) != 2 || args[0] != "delete" {
+		return errors.New("usage: chirpy chirp delete <chirp id>")
+	}
+
+	chirpID, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid chirp id: %w", err)
+	}
+
+	chirp, err := cfg.db.GetChirp(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("chirp %s not found", chirpID)
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, qtx, err := cfg.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := qtx.DeleteChirp(ctx, chirp.ID); err != nil {
+		return fmt.Errorf("couldn't delete chirp: %w", err)
+	}
+	if err := enqueueEvent(ctx, qtx, chirp.UserID, eventChirpDeleted, newChirp(chirp)); err != nil {
+		return fmt.Errorf("couldn't delete chirp: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("deleted chirp %s by %s\n", chirp.ID, chirp.UserID)
+	return nil
+}
+
+// runTokenCommand implements "chirpy token revoke-all --user <email>".
+func (cfg *apiConfig) runTokenCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "revoke-all" {
+		return errors.New("usage: chirpy token revoke-all --user <email>")
+	}
+
+	flags := flag.NewFlagSet("token revoke-all", flag.ContinueOnError)
+	email := flags.String("user", "", "email of the user")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("--user is required")
+	}
+
+	user, err := cfg.db.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	revoked, err := cfg.db.RevokeUserRefreshTokens(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't revoke refresh tokens: %w", err)
+	}
+
+	fmt.Printf("revoked %d refresh tokens for %s\n", revoked, user.Email)
+	return nil
+}
+
+func userLookupError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUserNotFound
+	}
+	return err
+}
+
+// hashPasswordArg hashes the password passed on the command line, or the
+// first line of stdin so it doesn't have to appear in the process list.
+func hashPasswordArg(password string) (string, error) {
+	if password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("couldn't read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+
+	return auth.HashPassword(password)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// UserSummary identifies a user in lists of other users.
+type UserSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+}
+
+func newUserSummaries(users []database.User) []UserSummary {
+	summaries := make([]UserSummary, len(users))
+	for i, user := range users {
+		summaries[i] = UserSummary{
+			ID:          user.ID,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			AvatarURL:   avatarURL(user.AvatarPath),
+		}
+	}
+	return summaries
+}
+
+// checkNotBlocked fails the request when either user has blocked the
+// other. Anything one user does to another, like following, goes through
+// it. On failure it writes the error response and returns false.
+func (cfg *apiConfig) checkNotBlocked(w http.ResponseWriter, r *http.Request, userID, otherID uuid.UUID) bool {
+	blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+		UserID:  userID,
+		OtherID: otherID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to check blocks", err)
+		return false
+	}
+	if blocked {
+		respondError(w, r, http.StatusForbidden, codeBlocked, "you can't interact with this user", nil)
+		return false
+	}
+	return true
+}
+
+// handlerBlock blocks the user in the path. Blocking also ends follows
+// in both directions, and the blocked user can't follow back.
+func (cfg *apiConfig) handlerBlock(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	blocked, ok := cfg.lookupHandle(w, r)
+	if !ok {
+		return
+	}
+	if blocked.ID == userID {
+		respondError(w, r, http.StatusBadRequest, codeCannotBlockSelf, "you can't block yourself", nil)
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to block user", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = qtx.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: blocked.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to block user", err)
+		return
+	}
+
+	_, err = qtx.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+		UserID:  userID,
+		OtherID: blocked.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to block user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to block user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblock(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	// Not lookupHandle, suspended users and accounts pending deletion must
+	// still be unblockable
+	blocked, err := cfg.db.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	_, err = cfg.db.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: blocked.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to unblock user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	users, err := cfg.db.GetBlockedUsers(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get blocked users", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newUserSummaries(users))
+}
+
+// handlerMute hides the user in the path from the authenticated user's
+// listings. Unlike a block, the muted user isn't told and can still
+// interact.
+func (cfg *apiConfig) handlerMute(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	muted, ok := cfg.lookupHandle(w, r)
+	if !ok {
+		return
+	}
+	if muted.ID == userID {
+		respondError(w, r, http.StatusBadRequest, codeCannotMuteSelf, "you can't mute yourself", nil)
+		return
+	}
+
+	_, err = cfg.db.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: muted.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to mute user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnmute(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	muted, err := cfg.db.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	_, err = cfg.db.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: muted.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to unmute user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetMutes(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	users, err := cfg.db.GetMutedUsers(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get muted users", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newUserSummaries(users))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// visibleAuthors returns the authors of the chirps user sees in the
+// timeline.
+func visibleAuthors(t *testing.T, cfg *apiConfig, user *testUser) map[uuid.UUID]bool {
+	t.Helper()
+
+	var chirps []Chirp
+	r := newTestRequest(t, "GET", "/api/chirps", user, nil)
+	serveTest(t, cfg.handlerGetAllChirps, r, http.StatusOK, &chirps)
+
+	authors := map[uuid.UUID]bool{}
+	for _, chirp := range chirps {
+		authors[chirp.UserID] = true
+	}
+	return authors
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, cfg, "viewer")
+	blocked := createTestUser(t, cfg, "blocked")
+	blocker := createTestUser(t, cfg, "blocker")
+	muted := createTestUser(t, cfg, "muted")
+	friend := createTestUser(t, cfg, "friend")
+	for _, user := range []testUser{blocked, blocker, muted, friend} {
+		if _, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID}); err != nil {
+			t.Fatalf("failed to create chirp: %v", err)
+		}
+	}
+
+	r := newTestRequest(t, "POST", "/api/users/blocked/block", &viewer, nil, "handle", "blocked")
+	serveTest(t, cfg.handlerBlock, r, http.StatusNoContent, nil)
+	r = newTestRequest(t, "POST", "/api/users/viewer/block", &blocker, nil, "handle", "viewer")
+	serveTest(t, cfg.handlerBlock, r, http.StatusNoContent, nil)
+	r = newTestRequest(t, "POST", "/api/users/muted/mute", &viewer, nil, "handle", "muted")
+	serveTest(t, cfg.handlerMute, r, http.StatusNoContent, nil)
+
+	tests := []struct {
+		name     string
+		user     *testUser
+		expected map[uuid.UUID]bool
+	}{
+		{
+			name:     "anonymous",
+			user:     nil,
+			expected: map[uuid.UUID]bool{blocked.ID: true, blocker.ID: true, muted.ID: true, friend.ID: true},
+		},
+		{
+			name:     "viewer",
+			user:     &viewer,
+			expected: map[uuid.UUID]bool{friend.ID: true},
+		},
+		{
+			name:     "blocked user",
+			user:     &blocked,
+			expected: map[uuid.UUID]bool{blocked.ID: true, blocker.ID: true, muted.ID: true, friend.ID: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authors := visibleAuthors(t, cfg, tt.user)
+			for id := range tt.expected {
+				if !authors[id] {
+					t.Errorf("expected chirps by %s", id)
+				}
+			}
+			for id := range authors {
+				if !tt.expected[id] {
+					t.Errorf("expected no chirps by %s", id)
+				}
+			}
+		})
+	}
+
+	r = newTestRequest(t, "POST", "/api/users/blocker/follow", &viewer, nil, "handle", "blocker")
+	serveTest(t, cfg.handlerFollow, r, http.StatusForbidden, nil)
+
+	// Undoing a block or mute still works once the other account can't be
+	// looked up
+	_, _, err := setAccountStatus(ctx, cfg.db, blocked.ID, userStatusSuspended, time.Now().Add(time.Hour), "spam")
+	if err != nil {
+		t.Fatalf("failed to suspend user: %v", err)
+	}
+	if _, err := cfg.db.ScheduleUserDeletion(ctx, muted.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	r = newTestRequest(t, "DELETE", "/api/users/blocked/block", &viewer, nil, "handle", "blocked")
+	serveTest(t, cfg.handlerUnblock, r, http.StatusNoContent, nil)
+	r = newTestRequest(t, "DELETE", "/api/users/muted/mute", &viewer, nil, "handle", "muted")
+	serveTest(t, cfg.handlerUnmute, r, http.StatusNoContent, nil)
+
+	hidden, err := cfg.db.GetHiddenAuthorIDs(ctx, viewer.ID)
+	if err != nil {
+		t.Fatalf("failed to get hidden authors: %v", err)
+	}
+	if len(hidden) != 1 || hidden[0] != blocker.ID {
+		t.Errorf("expected only %s to stay hidden, got %v", blocker.ID, hidden)
+	}
+}
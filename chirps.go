@@ -1,13 +1,16 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
 	"sort"
 	"time"
 
-	"github.com/Quak1/chirpy/internal/auth"
 	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/metrics"
 	"github.com/google/uuid"
 )
 
@@ -19,77 +22,124 @@ type Chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
+func newChirp(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+}
+
+// handlerCreateChirp publishes a chirp, or schedules it when publish_at
+// is given.
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string     `json:"body" validate:"required"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to get bearer token", err)
+		respondAuthError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to validate JWT", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
 		return
 	}
 
-	params := parameters{}
-	err = json.NewDecoder(r.Body).Decode(&params)
+	cleaned, err := validateChirp(params.Body, cfg.maxChirpLength(user))
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to parse request body", err)
+		respondValidationError(w, r, fieldError{Field: "body", Code: "too_long", Message: err.Error()})
+		return
+	}
+
+	if params.PublishAt != nil {
+		cfg.scheduleChirp(w, r, user, cleaned, *params.PublishAt)
 		return
 	}
 
-	cleaned, err := validateChirp(params.Body)
+	tx, qtx, err := cfg.beginTx(r.Context())
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, err.Error(), err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create chirp", err)
 		return
 	}
+	defer tx.Rollback()
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
 		Body:   cleaned,
 		UserID: userID,
 	})
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to create chirp", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create chirp", err)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, Chirp(chirp))
+	err = enqueueEvent(r.Context(), qtx, chirp.UserID, eventChirpCreated, newChirp(chirp))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create chirp", err)
+		return
+	}
+	metrics.ChirpsCreated.Inc()
+
+	respondJSON(w, http.StatusCreated, newChirp(chirp))
 }
 
+// handlerGetAllChirps lists chirps. With an access token, chirps by users
+// the viewer blocked or muted, or who blocked the viewer, are left out.
 func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request) {
 	sortQuery := r.URL.Query().Get("sort")
 	authorIdString := r.URL.Query().Get("author_id")
 	chirps := []database.Chirp{}
 	var err error
 
+	// Anonymous viewers have no blocks or mutes, uuid.Nil matches none
+	viewerID, _ := cfg.bearerUser(r)
+
 	if authorIdString == "" {
-		chirps, err = cfg.db.GetAllChirps(r.Context())
+		chirps, err = cfg.db.GetVisibleChirps(r.Context(), viewerID)
 		if err != nil {
-			respondJSONError(w, http.StatusInternalServerError, "failed to get chirps", err)
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get chirps", err)
 			return
 		}
 	} else {
 		userID, err := uuid.Parse(authorIdString)
 		if err != nil {
-			respondJSONError(w, http.StatusBadRequest, "failed to parse author id", err)
+			respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid author_id", err)
 			return
 		}
 
-		chirps, err = cfg.db.GetUserChirps(r.Context(), userID)
+		chirps, err = cfg.db.GetVisibleUserChirps(r.Context(), database.GetVisibleUserChirpsParams{
+			UserID:   userID,
+			ViewerID: viewerID,
+		})
 		if err != nil {
-			respondJSONError(w, http.StatusInternalServerError, "failed to get chirps", err)
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get chirps", err)
 			return
 		}
 	}
 
 	jsonChirps := make([]Chirp, len(chirps))
 	for i, chirp := range chirps {
-		jsonChirps[i] = Chirp(chirp)
+		jsonChirps[i] = newChirp(chirp)
 	}
 
 	if sortQuery == "desc" {
@@ -101,57 +151,195 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 	respondJSON(w, http.StatusOK, jsonChirps)
 }
 
-func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
+// lookupChirp returns the chirp with the ID in the request path. Deleted
+// chirps are gone rather than not found, the ID did exist. Chirps of users
+// whose account is being deleted are not found. On failure it writes the
+// error response and returns false.
+func (cfg *apiConfig) lookupChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to parse chirp id", err)
-		return
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid chirp id", err)
+		return database.Chirp{}, false
 	}
 
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	chirp, err := cfg.db.LookupChirp(r.Context(), chirpID)
 	if err != nil {
-		respondJSONError(w, http.StatusNotFound, "failed to get chirp", err)
+		respondLookupError(w, r, "chirp", err)
+		return database.Chirp{}, false
+	}
+	if chirp.DeletedAt.Valid {
+		respondError(w, r, http.StatusGone, codeGone, "chirp has been deleted", nil)
+		return database.Chirp{}, false
+	}
+	return chirp, true
+}
+
+func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
+	chirp, ok := cfg.lookupChirp(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the author still sees a chirp hidden by a moderator
+	if viewerID, _ := cfg.bearerUser(r); chirp.HiddenAt.Valid && viewerID != chirp.UserID {
+		respondLookupError(w, r, "chirp", sql.ErrNoRows)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Chirp(chirp))
+	respondJSON(w, http.StatusOK, newChirp(chirp))
 }
 
-func (cfg *apiConfig) handlerDelteChirp(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
+// handlerUpdateChirp changes the body of one of the user's chirps. A
+// chirp hidden by a moderator stays as it was when it was hidden.
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body" validate:"required"`
+	}
+
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to get bearer token", err)
+		respondAuthError(w, r, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to validate JWT", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
 		return
 	}
 
-	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if !cfg.hasFeature(user, featureEditChirps) {
+		respondError(w, r, http.StatusForbidden, codeFeatureUnavailable, "editing chirps requires Chirpy Red", nil)
+		return
+	}
+
+	chirp, ok := cfg.lookupChirp(w, r)
+	if !ok {
+		return
+	}
+
+	if chirp.UserID != userID {
+		respondError(w, r, http.StatusForbidden, codeForbidden, "only the author can change this chirp", nil)
+		return
+	}
+	if chirp.HiddenAt.Valid {
+		respondError(w, r, http.StatusForbidden, codeForbidden, "chirps hidden by a moderator can't be edited", nil)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	cleaned, err := validateChirp(params.Body, cfg.maxChirpLength(user))
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to parse chirp id", err)
+		respondValidationError(w, r, fieldError{Field: "body", Code: "too_long", Message: err.Error()})
 		return
 	}
 
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	tx, qtx, err := cfg.beginTx(r.Context())
 	if err != nil {
-		respondJSONError(w, http.StatusNotFound, "failed to get chirp", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update chirp", err)
+		return
+	}
+	defer tx.Rollback()
+
+	updated, err := qtx.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		ID:   chirp.ID,
+		Body: cleaned,
+	})
+	// Deleted or hidden since it was looked up
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusGone, codeGone, "chirp is no longer available", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update chirp", err)
+		return
+	}
+
+	err = enqueueEvent(r.Context(), qtx, updated.UserID, eventChirpUpdated, newChirp(updated))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update chirp", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newChirp(updated))
+}
+
+func (cfg *apiConfig) handlerDelteChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	chirp, ok := cfg.lookupChirp(w, r)
+	if !ok {
 		return
 	}
 
 	if chirp.UserID != userID {
-		respondJSONError(w, http.StatusForbidden, "author error", err)
+		respondError(w, r, http.StatusForbidden, codeForbidden, "only the author can change this chirp", err)
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete chirp", err)
+		return
+	}
+	defer tx.Rollback()
+
+	chirp, err = qtx.DeleteChirp(r.Context(), chirp.ID)
+	if err != nil {
+		respondLookupError(w, r, "chirp", err)
 		return
 	}
 
-	err = cfg.db.DeleteChirp(r.Context(), chirp.ID)
+	err = enqueueEvent(r.Context(), qtx, chirp.UserID, eventChirpDeleted, newChirp(chirp))
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't delete chirp", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete chirp", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// runChirpPurge hard deletes chirps that were deleted longer than the
+// retention window ago. Until then an admin can still restore them.
+func (cfg *apiConfig) runChirpPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-cfg.chirpRetention)
+		purged, err := cfg.db.PurgeDeletedChirps(ctx, sql.NullTime{Time: cutoff, Valid: true})
+		if err != nil {
+			slog.Error("failed to purge deleted chirps", "error", err)
+		} else if purged > 0 {
+			slog.Info("purged deleted chirps", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Quak1/chirpy/internal/database"
+)
+
+func TestChirpSoftDelete(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	author := createTestUser(t, cfg, "author")
+	makeChirpyRed(t, cfg, author)
+	moderator := createTestUser(t, cfg, "moderator")
+	makeAdmin(t, cfg, moderator)
+
+	chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "oops", UserID: author.ID})
+	if err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+	target := "/api/chirps/" + chirp.ID.String()
+	chirpID := chirp.ID.String()
+
+	r := newTestRequest(t, "DELETE", target, &author, nil, "chirpID", chirpID)
+	serveTest(t, cfg.handlerDelteChirp, r, http.StatusNoContent, nil)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    any
+	}{
+		{name: "get", handler: cfg.handlerGetChirp, method: "GET"},
+		{name: "update", handler: cfg.handlerUpdateChirp, method: "PUT", body: map[string]any{"body": "fixed"}},
+		{name: "delete again", handler: cfg.handlerDelteChirp, method: "DELETE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRequest(t, tt.method, target, &author, tt.body, "chirpID", chirpID)
+			serveTest(t, tt.handler, r, http.StatusGone, nil)
+		})
+	}
+
+	r = newTestRequest(t, "POST", "/api/moderation/chirps/"+chirpID+"/restore", &moderator,
+		map[string]any{"reason": "deleted by mistake"}, "chirpID", chirpID)
+	serveTest(t, cfg.handlerRestoreChirp, r, http.StatusOK, nil)
+
+	var restored Chirp
+	r = newTestRequest(t, "GET", target, nil, nil, "chirpID", chirpID)
+	serveTest(t, cfg.handlerGetChirp, r, http.StatusOK, &restored)
+	if restored.Body != "oops" {
+		t.Errorf("expected body %q, got %q", "oops", restored.Body)
+	}
+}
+
+func TestUpdateChirp(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	author := createTestUser(t, cfg, "author")
+	makeChirpyRed(t, cfg, author)
+
+	endpoint, err := cfg.db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		UserID: author.ID,
+		Url:    "https://example.com/hooks",
+		Secret: "secret",
+		Events: []string{eventChirpUpdated},
+	})
+	if err != nil {
+		t.Fatalf("failed to create webhook endpoint: %v", err)
+	}
+
+	visible, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "typo", UserID: author.ID})
+	if err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+	hidden, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "reported", UserID: author.ID})
+	if err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+	if _, err := cfg.db.HideChirp(ctx, hidden.ID); err != nil {
+		t.Fatalf("failed to hide chirp: %v", err)
+	}
+
+	r := newTestRequest(t, "PUT", "/api/chirps/"+hidden.ID.String(), &author,
+		map[string]any{"body": "nothing to see"}, "chirpID", hidden.ID.String())
+	serveTest(t, cfg.handlerUpdateChirp, r, http.StatusForbidden, nil)
+
+	var updated Chirp
+	r = newTestRequest(t, "PUT", "/api/chirps/"+visible.ID.String(), &author,
+		map[string]any{"body": "fixed"}, "chirpID", visible.ID.String())
+	serveTest(t, cfg.handlerUpdateChirp, r, http.StatusOK, &updated)
+	if updated.Body != "fixed" {
+		t.Errorf("expected body %q, got %q", "fixed", updated.Body)
+	}
+
+	deliveries, err := cfg.db.GetEndpointWebhookDeliveries(ctx, endpoint.ID)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event != eventChirpUpdated {
+		t.Errorf("expected one %s delivery, got %+v", eventChirpUpdated, deliveries)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks the validate tags on request parameter structs. Field
+// errors are reported with their JSON names.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("webhook_event", func(fl validator.FieldLevel) bool {
+		return slices.Contains(webhookEvents, fl.Field().String())
+	})
+	v.RegisterValidation("handle", func(fl validator.FieldLevel) bool {
+		return handlePattern.MatchString(fl.Field().String())
+	})
+	return v
+}
+
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+// decodeJSON strictly decodes a JSON request body into dst and validates
+// it. Bodies must be sent as application/json, fit in the configured
+// limit, contain a single value and no fields dst doesn't have. On failure
+// it writes the error response and returns false.
+func (cfg *apiConfig) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "request body must be application/json", err)
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.maxJSONBodyBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		respondDecodeError(w, r, err)
+		return false
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		respondDecodeError(w, r, errTrailingData)
+		return false
+	}
+
+	return validateParams(w, r, dst)
+}
+
+// validateParams checks the validate tags of params. On failure it writes
+// the error response and returns false.
+func validateParams(w http.ResponseWriter, r *http.Request, params any) bool {
+	err := validate.Struct(params)
+	if err == nil {
+		return true
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to validate request", err)
+		return false
+	}
+
+	fields := make([]fieldError, 0, len(validationErrs))
+	for _, e := range validationErrs {
+		// Drop the parameter struct's own name from the namespace,
+		// anonymous structs don't have one
+		field := e.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		fields = append(fields, fieldError{
+			Field:   field,
+			Code:    e.Tag(),
+			Message: validationMessage(e),
+		})
+	}
+	respondValidationError(w, r, fields...)
+	return false
+}
+
+func validationMessage(e validator.FieldError) string {
+	unit := "characters"
+	if kind := e.Kind(); kind == reflect.Slice || kind == reflect.Map {
+		unit = "items"
+	}
+	if e.Param() == "1" {
+		unit = strings.TrimSuffix(unit, "s")
+	}
+
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		return "is required to change " + strings.ToLower(strings.ReplaceAll(e.Param(), " ", " or "))
+	case "required_if":
+		field, value, _ := strings.Cut(e.Param(), " ")
+		return fmt.Sprintf("is required when %s is %s", strings.ToLower(field), value)
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an absolute http or https URL"
+	case "min":
+		return fmt.Sprintf("must be at least %s %s", e.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s %s", e.Param(), unit)
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(e.Param(), " ", ", ")
+	case "webhook_event":
+		return "must be one of " + strings.Join(webhookEvents, ", ")
+	case "handle":
+		return "must be 3 to 30 letters, digits or underscores"
+	default:
+		return "is invalid"
+	}
+}
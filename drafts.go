@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+// Draft is a chirp saved without publishing it. Drafts are private to
+// their author, other users' drafts are reported as not found.
+type Draft struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+func newDraft(draft database.Draft) Draft {
+	return Draft{
+		ID:        draft.ID,
+		CreatedAt: draft.CreatedAt,
+		UpdatedAt: draft.UpdatedAt,
+		Body:      draft.Body,
+		UserID:    draft.UserID,
+	}
+}
+
+// handlerCreateDraft saves a draft. The body is only checked when the
+// draft is published, a draft may be empty or too long for now.
+func (cfg *apiConfig) handlerCreateDraft(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	draft, err := cfg.db.CreateDraft(r.Context(), database.CreateDraftParams{
+		UserID: userID,
+		Body:   params.Body,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create draft", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, newDraft(draft))
+}
+
+// handlerGetDrafts lists the authenticated user's drafts, the most
+// recently changed first.
+func (cfg *apiConfig) handlerGetDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	drafts, err := cfg.db.GetUserDrafts(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get drafts", err)
+		return
+	}
+
+	res := make([]Draft, len(drafts))
+	for i, draft := range drafts {
+		res[i] = newDraft(draft)
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerGetDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid draft id", err)
+		return
+	}
+
+	draft, err := cfg.db.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondLookupError(w, r, "draft", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newDraft(draft))
+}
+
+func (cfg *apiConfig) handlerUpdateDraft(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid draft id", err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	draft, err := cfg.db.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:     draftID,
+		UserID: userID,
+		Body:   params.Body,
+	})
+	if err != nil {
+		respondLookupError(w, r, "draft", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newDraft(draft))
+}
+
+func (cfg *apiConfig) handlerDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid draft id", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete draft", err)
+		return
+	}
+	if deleted == 0 {
+		respondLookupError(w, r, "draft", sql.ErrNoRows)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPublishDraft turns a draft into a chirp. The draft is removed in
+// the same transaction the chirp is created in, so publishing twice at
+// once creates one chirp and the other request finds no draft. A draft
+// that fails validation is kept as it was.
+func (cfg *apiConfig) handlerPublishDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid draft id", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to publish draft", err)
+		return
+	}
+	defer tx.Rollback()
+
+	draft, err := qtx.TakeDraft(r.Context(), database.TakeDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondLookupError(w, r, "draft", err)
+		return
+	}
+
+	if draft.Body == "" {
+		respondValidationError(w, r, fieldError{Field: "body", Code: "required", Message: "is required"})
+		return
+	}
+	cleaned, err := validateChirp(draft.Body, cfg.maxChirpLength(user))
+	if err != nil {
+		respondValidationError(w, r, fieldError{Field: "body", Code: "too_long", Message: err.Error()})
+		return
+	}
+
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:   cleaned,
+		UserID: userID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to publish draft", err)
+		return
+	}
+
+	err = enqueueEvent(r.Context(), qtx, chirp.UserID, eventChirpCreated, newChirp(chirp))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to publish draft", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to publish draft", err)
+		return
+	}
+	metrics.ChirpsCreated.Inc()
+
+	respondJSON(w, http.StatusCreated, newChirp(chirp))
+}
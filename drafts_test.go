@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPublishDraft(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	author := createTestUser(t, cfg, "author")
+
+	createDraft := func(body string) Draft {
+		t.Helper()
+		var draft Draft
+		r := newTestRequest(t, "POST", "/api/drafts", &author, map[string]any{"body": body})
+		serveTest(t, cfg.handlerCreateDraft, r, http.StatusCreated, &draft)
+		return draft
+	}
+	publishRequest := func(draft Draft) *http.Request {
+		return newTestRequest(t, "POST", "/api/drafts/"+draft.ID.String()+"/publish", &author, nil,
+			"draftID", draft.ID.String())
+	}
+
+	// A draft that fails validation is kept for the author to fix
+	tooLong := createDraft(strings.Repeat("a", maxChirpLength+1))
+	serveTest(t, cfg.handlerPublishDraft, publishRequest(tooLong), http.StatusBadRequest, nil)
+	r := newTestRequest(t, "GET", "/api/drafts/"+tooLong.ID.String(), &author, nil, "draftID", tooLong.ID.String())
+	serveTest(t, cfg.handlerGetDraft, r, http.StatusOK, nil)
+
+	// Publishing the same draft twice at once creates one chirp
+	draft := createDraft("ready")
+	const publishers = 2
+	requests := make([]*http.Request, publishers)
+	for i := range requests {
+		requests[i] = publishRequest(draft)
+	}
+	codes := make([]int, publishers)
+	var wg sync.WaitGroup
+	for i, r := range requests {
+		wg.Go(func() {
+			rec := httptest.NewRecorder()
+			cfg.handlerPublishDraft(rec, r)
+			codes[i] = rec.Code
+		})
+	}
+	wg.Wait()
+
+	created, missing := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusNotFound:
+			missing++
+		}
+	}
+	if created != 1 || missing != 1 {
+		t.Fatalf("expected one chirp and one missing draft, got statuses %v", codes)
+	}
+
+	chirps, err := cfg.db.GetUserChirps(ctx, author.ID)
+	if err != nil {
+		t.Fatalf("failed to get chirps: %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "ready" {
+		t.Errorf("expected one published chirp, got %+v", chirps)
+	}
+
+	r = newTestRequest(t, "GET", "/api/drafts/"+draft.ID.String(), &author, nil, "draftID", draft.ID.String())
+	serveTest(t, cfg.handlerGetDraft, r, http.StatusNotFound, nil)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Quak1/chirpy/internal/database"
+)
+
+type feature string
+
+const (
+	featureLongChirps       feature = "long_chirps"
+	featureEditChirps       feature = "edit_chirps"
+	featureHigherRateLimits feature = "higher_rate_limits"
+	featureScheduledChirps  feature = "scheduled_chirps"
+)
+
+var redFeatures = []feature{
+	featureLongChirps,
+	featureEditChirps,
+	featureHigherRateLimits,
+	featureScheduledChirps,
+}
+
+// parseFeatures turns a list of feature names into the set of features
+// enabled for Chirpy Red members. A nil list, CHIRPY_RED_FEATURES being
+// unset, enables all of them. An empty list enables none.
+func parseFeatures(names []string) (map[feature]bool, error) {
+	enabled := map[feature]bool{}
+	if names == nil {
+		for _, f := range redFeatures {
+			enabled[f] = true
+		}
+		return enabled, nil
+	}
+
+	for _, name := range names {
+		f := feature(name)
+		if !slices.Contains(redFeatures, f) {
+			return nil, fmt.Errorf("unknown feature %q", f)
+		}
+		enabled[f] = true
+	}
+
+	return enabled, nil
+}
+
+// hasFeature reports whether the user is entitled to a premium feature.
+func (cfg *apiConfig) hasFeature(user database.User, f feature) bool {
+	return user.IsChirpyRed && cfg.redFeatures[f]
+}
+
+func (cfg *apiConfig) maxChirpLength(user database.User) int {
+	if cfg.hasFeature(user, featureLongChirps) {
+		return maxLongChirpLength
+	}
+	return maxChirpLength
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	checkOK      = "ok"
+	checkFailed  = "failed"
+	checkTimeout = "timeout"
+)
+
+// healthCheck is the result of a readiness check. The endpoints are
+// public, so the error is only logged, it may name hosts or users.
+type healthCheck struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	err        error
+}
+
+// handlerLivez reports that the process is up and serving requests. It
+// never touches dependencies so a database outage doesn't get the server
+// restarted.
+func (cfg *apiConfig) handlerLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// handlerReadyz reports whether the server can handle traffic, meaning the
+// database is reachable and migrated. ?verbose returns the result of each
+// check as JSON.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"database":   cfg.runCheck(r.Context(), cfg.checkDatabase),
+		"migrations": cfg.runCheck(r.Context(), cfg.checkMigrations),
+	}
+
+	status := checkOK
+	statusCode := http.StatusOK
+	for name, check := range checks {
+		if check.Status != checkOK {
+			status = checkFailed
+			statusCode = http.StatusServiceUnavailable
+			loggerFrom(r.Context()).Warn("readiness check failed", "check", name, "error", check.err)
+		}
+	}
+
+	if !r.URL.Query().Has("verbose") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(statusCode)
+		if statusCode == http.StatusOK {
+			w.Write([]byte("OK"))
+		} else {
+			w.Write([]byte("Service Unavailable"))
+		}
+		return
+	}
+
+	type response struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	}
+	respondJSON(w, statusCode, response{
+		Status: status,
+		Checks: checks,
+	})
+}
+
+func (cfg *apiConfig) runCheck(ctx context.Context, check func(context.Context) error) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, cfg.readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := healthCheck{
+		Status:     checkOK,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = checkFailed
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = checkTimeout
+		}
+		result.err = err
+	}
+	return result
+}
+
+func (cfg *apiConfig) checkDatabase(ctx context.Context) error {
+	return cfg.dbConn.PingContext(ctx)
+}
+
+func (cfg *apiConfig) checkMigrations(ctx context.Context) error {
+	return checkSchema(ctx, cfg.migrator)
+}
+
+// waitForDB pings the database until it answers, backing off between
+// attempts, so the server can start before Postgres has finished booting.
+func waitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		slog.Warn("waiting for database", "attempt", attempt, "retry_in", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 10*time.Second)
+	}
+}
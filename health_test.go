@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCheck(t *testing.T) {
+	secret := "dial tcp db.internal:5432: password authentication failed for user \"chirpy\""
+
+	tests := []struct {
+		name     string
+		check    func(context.Context) error
+		expected string
+	}{
+		{
+			name:     "passing",
+			check:    func(context.Context) error { return nil },
+			expected: checkOK,
+		},
+		{
+			name:     "failing",
+			check:    func(context.Context) error { return errors.New(secret) },
+			expected: checkFailed,
+		},
+		{
+			name: "too slow",
+			check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			expected: checkTimeout,
+		},
+	}
+
+	cfg := &apiConfig{readinessTimeout: 10 * time.Millisecond}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := cfg.runCheck(context.Background(), tt.check)
+			if result.Status != tt.expected {
+				t.Errorf("expected status %s, got %s", tt.expected, result.Status)
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("failed to encode result: %v", err)
+			}
+			if strings.Contains(string(data), "db.internal") {
+				t.Errorf("expected no error detail, got %s", data)
+			}
+		})
+	}
+}
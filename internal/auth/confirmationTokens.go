@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MakeConfirmationToken returns a random token to send to the user and
+// the hash to store. Only the hash is stored so a database leak can't be
+// used to confirm pending changes.
+func MakeConfirmationToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = hex.EncodeToString(b)
+	return token, HashToken(token)
+}
+
+// HashToken returns the hash stored for a confirmation token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,21 @@
+package auth
+
+import "testing"
+
+func TestMakeConfirmationToken(t *testing.T) {
+	token, hash := MakeConfirmationToken()
+	if len(token) != 64 {
+		t.Errorf("token length = %d, want 64", len(token))
+	}
+	if hash == token {
+		t.Error("hash equals the token")
+	}
+	if HashToken(token) != hash {
+		t.Error("HashToken(token) doesn't match the returned hash")
+	}
+
+	other, _ := MakeConfirmationToken()
+	if other == token {
+		t.Error("two tokens are equal")
+	}
+}
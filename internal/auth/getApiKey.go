@@ -1,21 +0,0 @@
-package auth
-
-import (
-	"fmt"
-	"net/http"
-	"strings"
-)
-
-func GetApiKey(headers http.Header) (string, error) {
-	authHeader := headers.Get("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("missing Authorization header")
-	}
-
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "ApiKey" {
-		return "", fmt.Errorf("bad Authorization header")
-	}
-
-	return parts[1], nil
-}
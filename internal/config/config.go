@@ -0,0 +1,371 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the server configuration. Every field can be set from an
+// environment variable (the env tag), from NAME_FILE pointing at a file
+// holding the value (for Docker and Kubernetes secrets), or from the
+// optional YAML config file (the yaml tag). Environment variables win over
+// the file. Fields tagged redact are hidden when the config is logged.
+//
+// A list that is set but empty, like CHIRPY_RED_FEATURES= or
+// chirpy_red_features: [], is non-nil, so it can be told apart from one
+// that is unset.
+type Config struct {
+	DBURL                string        `env:"DB_URL" yaml:"db_url" redact:"dsn"`
+	DBConnectTimeout     time.Duration `env:"DB_CONNECT_TIMEOUT" yaml:"db_connect_timeout"`
+	MigrateOnStart       bool          `env:"MIGRATE_ON_START" yaml:"migrate_on_start"`
+	ReadinessTimeout     time.Duration `env:"READINESS_TIMEOUT" yaml:"readiness_timeout"`
+	Platform             string        `env:"PLATFORM" yaml:"platform"`
+	TokenSecret          string        `env:"TOKEN_SECRET" yaml:"token_secret" redact:"all"`
+	PolkaWebhookSecrets  []string      `env:"POLKA_WEBHOOK_SECRETS" yaml:"polka_webhook_secrets" redact:"all"`
+	RedFeatures          []string      `env:"CHIRPY_RED_FEATURES" yaml:"chirpy_red_features"`
+	LogLevel             string        `env:"LOG_LEVEL" yaml:"log_level"`
+	TracesExporter       string        `env:"OTEL_TRACES_EXPORTER" yaml:"otel_traces_exporter"`
+	RateLimitStore       string        `env:"RATE_LIMIT_STORE" yaml:"rate_limit_store"`
+	RateLimits           []string      `env:"RATE_LIMITS" yaml:"rate_limits"`
+	TrustProxy           bool          `env:"TRUST_PROXY" yaml:"trust_proxy"`
+	MediaDir             string        `env:"MEDIA_DIR" yaml:"media_dir"`
+	AccountDeletionGrace time.Duration `env:"ACCOUNT_DELETION_GRACE_PERIOD" yaml:"account_deletion_grace_period"`
+	ChirpRetention       time.Duration `env:"CHIRP_RETENTION" yaml:"chirp_retention"`
+	Server               Server        `yaml:"server"`
+	SMTP                 SMTP          `yaml:"smtp"`
+}
+
+// Server configures the HTTP listeners. /metrics is served on MetricsAddr
+// rather than with the API, so it can be kept off the public network.
+type Server struct {
+	Addr              string        `env:"SERVER_ADDR" yaml:"addr"`
+	MetricsAddr       string        `env:"SERVER_METRICS_ADDR" yaml:"metrics_addr"`
+	ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT" yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT" yaml:"write_timeout"`
+	IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT" yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout"`
+	MaxHeaderBytes    int           `env:"SERVER_MAX_HEADER_BYTES" yaml:"max_header_bytes"`
+	MaxBodyBytes      int64         `env:"SERVER_MAX_BODY_BYTES" yaml:"max_body_bytes"`
+	MaxJSONBodyBytes  int64         `env:"SERVER_MAX_JSON_BODY_BYTES" yaml:"max_json_body_bytes"`
+}
+
+// SMTP configures outgoing email. Without an address, emails are logged
+// instead of sent.
+type SMTP struct {
+	Addr     string `env:"SMTP_ADDR" yaml:"addr"`
+	From     string `env:"SMTP_FROM" yaml:"from"`
+	Username string `env:"SMTP_USERNAME" yaml:"username"`
+	Password string `env:"SMTP_PASSWORD" yaml:"password" redact:"all"`
+}
+
+const minTokenSecretLength = 32
+
+func defaults() Config {
+	return Config{
+		DBConnectTimeout:     time.Minute,
+		ReadinessTimeout:     2 * time.Second,
+		Platform:             "prod",
+		LogLevel:             "info",
+		TracesExporter:       "none",
+		RateLimitStore:       "memory",
+		MediaDir:             "media",
+		AccountDeletionGrace: 30 * 24 * time.Hour,
+		ChirpRetention:       30 * 24 * time.Hour,
+		Server: Server{
+			Addr:              ":8080",
+			MetricsAddr:       ":2112",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+			MaxJSONBodyBytes:  64 << 10,
+		},
+		SMTP: SMTP{
+			From: "chirpy@localhost",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file at path (if
+// path is not empty), .env and the environment, in increasing order of
+// precedence, and validates the result.
+func Load(path string) (Config, error) {
+	cfg := defaults()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	// .env never overrides variables that are already set
+	godotenv.Load()
+
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func loadEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		value, ok, err := lookupEnv(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv reads NAME, falling back to the contents of the file named by
+// NAME_FILE.
+func lookupEnv(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case []string:
+		list := []string{}
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration like 30s, got %q", value)
+		}
+		field.SetInt(int64(d))
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		field.SetBool(b)
+	case int, int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		field.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing value at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	} else if u, err := url.Parse(c.DBURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		errs = append(errs, errors.New("DB_URL must be a postgres:// URL"))
+	}
+
+	if len(c.TokenSecret) < minTokenSecretLength {
+		errs = append(errs, fmt.Errorf("TOKEN_SECRET must be at least %d characters", minTokenSecretLength))
+	}
+
+	if c.Platform != "dev" && c.Platform != "prod" {
+		errs = append(errs, fmt.Errorf("PLATFORM must be dev or prod, got %q", c.Platform))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+
+	switch c.TracesExporter {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("OTEL_TRACES_EXPORTER must be none, otlp or stdout, got %q", c.TracesExporter))
+	}
+
+	switch c.RateLimitStore {
+	case "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres, got %q", c.RateLimitStore))
+	}
+
+	if c.MediaDir == "" {
+		errs = append(errs, errors.New("MEDIA_DIR is required"))
+	}
+	if c.AccountDeletionGrace < 0 {
+		errs = append(errs, errors.New("ACCOUNT_DELETION_GRACE_PERIOD must not be negative"))
+	}
+	if c.ChirpRetention < 0 {
+		errs = append(errs, errors.New("CHIRP_RETENTION must not be negative"))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("SERVER_ADDR is required"))
+	}
+	if c.Server.MetricsAddr == "" {
+		errs = append(errs, errors.New("SERVER_METRICS_ADDR is required"))
+	} else if c.Server.MetricsAddr == c.Server.Addr {
+		errs = append(errs, errors.New("SERVER_METRICS_ADDR must differ from SERVER_ADDR"))
+	}
+	if c.ReadinessTimeout <= 0 {
+		errs = append(errs, errors.New("READINESS_TIMEOUT must be positive"))
+	}
+	if c.DBConnectTimeout <= 0 {
+		errs = append(errs, errors.New("DB_CONNECT_TIMEOUT must be positive"))
+	}
+
+	for name, d := range map[string]time.Duration{
+		"SERVER_READ_TIMEOUT":        c.Server.ReadTimeout,
+		"SERVER_READ_HEADER_TIMEOUT": c.Server.ReadHeaderTimeout,
+		"SERVER_WRITE_TIMEOUT":       c.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        c.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    c.Server.ShutdownTimeout,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", name))
+		}
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("SERVER_MAX_HEADER_BYTES must be positive"))
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("SERVER_MAX_BODY_BYTES must be positive"))
+	}
+	if c.Server.MaxJSONBodyBytes <= 0 {
+		errs = append(errs, errors.New("SERVER_MAX_JSON_BODY_BYTES must be positive"))
+	}
+
+	if c.SMTP.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTP.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("SMTP_ADDR must be host:port, got %q", c.SMTP.Addr))
+		}
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			errs = append(errs, fmt.Errorf("SMTP_FROM must be an email address, got %q", c.SMTP.From))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogValue renders the effective configuration keyed by environment
+// variable name with secrets redacted, so the config can be logged as is.
+func (c Config) LogValue() slog.Value {
+	attrs := []slog.Attr{}
+	collectAttrs(reflect.ValueOf(c), &attrs)
+	return slog.GroupValue(attrs...)
+}
+
+func collectAttrs(v reflect.Value, attrs *[]slog.Attr) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeFor[time.Duration]() {
+			collectAttrs(field, attrs)
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		value := field.Interface()
+		switch t.Field(i).Tag.Get("redact") {
+		case "all":
+			if !field.IsZero() && !(field.Kind() == reflect.Slice && field.Len() == 0) {
+				value = "[redacted]"
+			}
+		case "dsn":
+			value = redactDSN(field.String())
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		*attrs = append(*attrs, slog.Any(name, value))
+	}
+}
+
+// dsnSecretParams are the connection parameters that hold credentials.
+var dsnSecretParams = []string{"password", "sslpassword"}
+
+// dsnKeyValueSecret matches a secret in a key=value connection string,
+// quoted or not.
+var dsnKeyValueSecret = regexp.MustCompile(`(?i)\b(` + strings.Join(dsnSecretParams, "|") + `)\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactDSN hides the credentials of a Postgres connection string, given
+// either as a URL or as key=value pairs.
+func redactDSN(dsn string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsnKeyValueSecret.ReplaceAllString(dsn, "$1=xxxxx")
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "[redacted]"
+	}
+	query := u.Query()
+	for _, param := range dsnSecretParams {
+		if query.Has(param) {
+			query.Set(param, "xxxxx")
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.Redacted()
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
@@ -14,7 +15,7 @@ import (
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (body, user_id)
 VALUES ($1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, deleted_at
 `
 
 type CreateChirpParams struct {
@@ -31,22 +32,37 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1
+const deleteChirp = `-- name: DeleteChirp :one
+UPDATE chirps
+SET deleted_at = now()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, deleted_at
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, deleteChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -65,6 +81,8 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -80,8 +98,8 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -93,13 +111,35 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getChirpIncludingDeleted = `-- name: GetChirpIncludingDeleted :one
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) GetChirpIncludingDeleted(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpIncludingDeleted, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserChirps = `-- name: GetUserChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -118,6 +158,144 @@ func (q *Queries) GetUserChirps(ctx context.Context, userID uuid.UUID) ([]Chirp,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserChirpsIncludingDeleted = `-- name: GetUserChirpsIncludingDeleted :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetUserChirpsIncludingDeleted(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getUserChirpsIncludingDeleted, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleChirps = `-- name: GetVisibleChirps :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE hidden_at IS NULL AND deleted_at IS NULL AND NOT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id)
+    OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $1)
+) AND NOT EXISTS (
+  SELECT 1 FROM mutes
+  WHERE mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+) AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+)
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetVisibleChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getVisibleChirps, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleUserChirps = `-- name: GetVisibleUserChirps :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, deleted_at FROM chirps
+WHERE user_id = $1 AND hidden_at IS NULL AND deleted_at IS NULL AND NOT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocks.blocker_id = $2 AND blocks.blocked_id = chirps.user_id)
+    OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $2)
+) AND NOT EXISTS (
+  SELECT 1 FROM mutes
+  WHERE mutes.muter_id = $2 AND mutes.muted_id = chirps.user_id
+) AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+)
+ORDER BY created_at ASC
+`
+
+type GetVisibleUserChirpsParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleUserChirps(ctx context.Context, arg GetVisibleUserChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getVisibleUserChirps, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -131,3 +309,108 @@ func (q *Queries) GetUserChirps(ctx context.Context, userID uuid.UUID) ([]Chirp,
 	}
 	return items, nil
 }
+
+const hideChirp = `-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = COALESCE(hidden_at, now())
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, deleted_at
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, hideChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const lookupChirp = `-- name: LookupChirp :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.hidden_at, chirps.deleted_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.deleted_at IS NULL
+`
+
+func (q *Queries) LookupChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, lookupChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, deleted_at
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = now()
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, deleted_at
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
@@ -6,17 +6,83 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	HiddenAt  sql.NullTime
+	DeletedAt sql.NullTime
+}
+
+type ChirpEvent struct {
+	ID             int64
+	CreatedAt      time.Time
+	Event          string
+	ChirpID        uuid.UUID
+	UserID         uuid.UUID
+	Body           string
+	ChirpCreatedAt time.Time
+	ChirpUpdatedAt time.Time
+}
+
+type Draft struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Body      string
+}
+
+type EmailChange struct {
+	TokenHash string
+	UserID    uuid.UUID
+	NewEmail  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	ModeratorID  uuid.NullUUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Reason       string
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,6 +94,49 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ResolvedAt sql.NullTime
+	ResolvedBy uuid.NullUUID
+}
+
+type ScheduledChirp struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Body      string
+	PublishAt time.Time
+}
+
+type Subscription struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	UserID             uuid.UUID
+	Plan               string
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   sql.NullTime
+}
+
+type SubscriptionHistory struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	SubscriptionID uuid.UUID
+	Event          string
+	Plan           string
+	Status         string
+	PeriodStart    time.Time
+	PeriodEnd      sql.NullTime
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
@@ -35,4 +144,55 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	Role           string
+	Status         string
+	Handle         string
+	DisplayName    string
+	Bio            string
+	AvatarPath     sql.NullString
+	DeletedAt      sql.NullTime
+	SuspendedUntil sql.NullTime
+	StatusReason   string
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	EndpointID     uuid.UUID
+	Event          string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+}
+
+type WebhookDeliveryAttempt struct {
+	ID             uuid.UUID
+	AttemptedAt    time.Time
+	DeliveryID     uuid.UUID
+	ResponseStatus sql.NullInt32
+	Error          sql.NullString
+	DurationMs     int32
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	Active    bool
+}
+
+type WebhookEvent struct {
+	Provider   string
+	ID         string
+	Event      string
+	ReceivedAt time.Time
 }
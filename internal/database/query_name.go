@@ -0,0 +1,15 @@
+package database
+
+import "strings"
+
+// QueryName extracts the query name from the "-- name: Name :kind" comment
+// sqlc puts at the start of every generated query.
+func QueryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "unknown"
+	}
+
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
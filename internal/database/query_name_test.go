@@ -0,0 +1,35 @@
+package database
+
+import "testing"
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "sqlc query",
+			query:    "-- name: GetChirp :one\nSELECT id FROM chirps\nWHERE id = $1\n",
+			expected: "GetChirp",
+		},
+		{
+			name:     "hand written query",
+			query:    "SELECT 1",
+			expected: "unknown",
+		},
+		{
+			name:     "empty query",
+			query:    "",
+			expected: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryName(tt.query); got != tt.expected {
+				t.Errorf("QueryName() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
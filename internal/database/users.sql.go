@@ -7,15 +7,46 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users
+SET deleted_at = NULL, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (hashed_password, email)
 VALUES ($1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
 `
 
 type CreateUserParams struct {
@@ -33,6 +64,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
 	)
 	return i, err
 }
@@ -46,8 +86,27 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const expireChirpyRed = `-- name: ExpireChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = false, updated_at = now()
+WHERE is_chirpy_red AND NOT EXISTS (
+  SELECT 1 FROM subscriptions
+  WHERE subscriptions.user_id = users.id
+    AND subscriptions.status = 'active'
+    AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > now())
+)
+`
+
+func (q *Queries) ExpireChirpyRed(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason FROM users
 WHERE users.email = $1
 `
 
@@ -61,30 +120,352 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason FROM users
+WHERE lower(handle) = lower($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT users.id, users.handle, users.display_name, users.bio, users.avatar_path, users.is_chirpy_red, users.created_at,
+  (SELECT count(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+  (SELECT count(*) FROM follows WHERE follows.follower_id = users.id) AS following_count,
+  (SELECT count(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL) AS chirp_count
+FROM users
+WHERE lower(users.handle) = lower($1)
+  AND (users.status = 'active' OR (users.status = 'suspended' AND users.suspended_until <= now()))
+  AND users.deleted_at IS NULL
+`
+
+type GetUserProfileRow struct {
+	ID             uuid.UUID
+	Handle         string
+	DisplayName    string
+	Bio            string
+	AvatarPath     sql.NullString
+	IsChirpyRed    bool
+	CreatedAt      time.Time
+	FollowerCount  int64
+	FollowingCount int64
+	ChirpCount     int64
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, handle string) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, handle)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.IsChirpyRed,
+		&i.CreatedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
+		&i.ChirpCount,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :many
+DELETE FROM users
+WHERE deleted_at < $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedAt sql.NullTime) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedUsers, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Role,
+			&i.Status,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarPath,
+			&i.DeletedAt,
+			&i.SuspendedUntil,
+			&i.StatusReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deleted_at = COALESCE(deleted_at, now()), updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const setUserAvatar = `-- name: SetUserAvatar :one
 UPDATE users
-SET hashed_password = $2, email = $3, updated_at = $4
-WHERE users.id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET avatar_path = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
 `
 
-type UpdateUserParams struct {
+type SetUserAvatarParams struct {
+	ID         uuid.UUID
+	AvatarPath sql.NullString
+}
+
+func (q *Queries) SetUserAvatar(ctx context.Context, arg SetUserAvatarParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserAvatar, arg.ID, arg.AvatarPath)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const setUserEmail = `-- name: SetUserEmail :one
+UPDATE users
+SET email = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+type SetUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) SetUserEmail(ctx context.Context, arg SetUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const setUserPassword = `-- name: SetUserPassword :one
+UPDATE users
+SET hashed_password = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+type SetUserPasswordParams struct {
 	ID             uuid.UUID
 	HashedPassword string
-	Email          string
-	UpdatedAt      time.Time
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser,
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
+
+const setUserStatus = `-- name: SetUserStatus :one
+UPDATE users
+SET status = $2, suspended_until = $3, status_reason = $4, updated_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+type SetUserStatusParams struct {
+	ID             uuid.UUID
+	Status         string
+	SuspendedUntil sql.NullTime
+	StatusReason   string
+}
+
+func (q *Queries) SetUserStatus(ctx context.Context, arg SetUserStatusParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserStatus,
 		arg.ID,
-		arg.HashedPassword,
-		arg.Email,
-		arg.UpdatedAt,
+		arg.Status,
+		arg.SuspendedUntil,
+		arg.StatusReason,
 	)
 	var i User
 	err := row.Scan(
@@ -94,17 +475,76 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
 	)
 	return i, err
 }
 
-const upgradeChirpyRed = `-- name: UpgradeChirpyRed :exec
+const syncChirpyRed = `-- name: SyncChirpyRed :exec
 UPDATE users
-SET is_chirpy_red = true
+SET is_chirpy_red = EXISTS (
+  SELECT 1 FROM subscriptions
+  WHERE subscriptions.user_id = users.id
+    AND subscriptions.status = 'active'
+    AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > now())
+), updated_at = now()
 WHERE id = $1
 `
 
-func (q *Queries) UpgradeChirpyRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeChirpyRed, id)
+func (q *Queries) SyncChirpyRed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, syncChirpyRed, id)
 	return err
 }
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = COALESCE($1, handle),
+  display_name = COALESCE($2, display_name),
+  bio = COALESCE($3, bio),
+  updated_at = now()
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, status, handle, display_name, bio, avatar_path, deleted_at, suspended_until, status_reason
+`
+
+type UpdateUserProfileParams struct {
+	Handle      sql.NullString
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.Status,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarPath,
+		&i.DeletedAt,
+		&i.SuspendedUntil,
+		&i.StatusReason,
+	)
+	return i, err
+}
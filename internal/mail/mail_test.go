@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com",
+		Subject: "Confirm your new email",
+		Body:    "line one\nline two",
+	}
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got := string(msg.Bytes("chirpy@example.com", date))
+
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Confirm your new email\r\n",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestMessageBytesEncodesSubject(t *testing.T) {
+	msg := Message{To: "user@example.com", Subject: "Bienvenue à Chirpy"}
+
+	got := string(msg.Bytes("chirpy@example.com", time.Now()))
+
+	if !strings.Contains(got, "Subject: =?utf-8?q?Bienvenue_=C3=A0_Chirpy?=\r\n") {
+		t.Errorf("subject not encoded:\n%s", got)
+	}
+}
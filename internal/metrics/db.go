@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+)
+
+type instrumentedDB struct {
+	db database.DBTX
+}
+
+// InstrumentDB wraps db so every query records its latency under the name
+// sqlc gave it.
+func InstrumentDB(db database.DBTX) database.DBTX {
+	return instrumentedDB{db: db}
+}
+
+func (i instrumentedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer observe(query, time.Now())
+	return i.db.ExecContext(ctx, query, args...)
+}
+
+func (i instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	defer observe(query, time.Now())
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i instrumentedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer observe(query, time.Now())
+	return i.db.QueryContext(ctx, query, args...)
+}
+
+func (i instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer observe(query, time.Now())
+	return i.db.QueryRowContext(ctx, query, args...)
+}
+
+func observe(query string, start time.Time) {
+	DBQueryDuration.WithLabelValues(database.QueryName(query)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chirpy_http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chirpy_db_query_duration_seconds",
+		Help:    "Database query latency by sqlc query name.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+
+	ChirpsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_chirps_created_total",
+		Help: "Chirps created.",
+	})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	WebhooksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_webhooks_received_total",
+		Help: "Verified incoming webhooks by provider and event.",
+	}, []string{"provider", "event"})
+
+	FileserverHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_fileserver_hits_total",
+		Help: "Requests served by the /app file server.",
+	})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		DBQueryDuration,
+		ChirpsCreated,
+		Logins,
+		WebhooksReceived,
+		FileserverHits,
+	)
+}
+
+// Handler serves all metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	limit := Limit{Burst: 3, Period: 3 * time.Second}
+
+	tests := []struct {
+		name          string
+		after         time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "first request", after: 0, wantAllowed: true, wantRemaining: 2},
+		{name: "second request", after: 0, wantAllowed: true, wantRemaining: 1},
+		{name: "third request", after: 0, wantAllowed: true, wantRemaining: 0},
+		{name: "bucket empty", after: 0, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{name: "partly refilled", after: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+		{name: "refilled one token", after: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{name: "refill capped at burst", after: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+
+	store := NewMemoryStore()
+	now := start
+	store.now = func() time.Time { return now }
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.after)
+
+			res, err := store.Take(context.Background(), "user", limit)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if res.Allowed != tc.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", res.Allowed, tc.wantAllowed)
+			}
+			if res.Remaining != tc.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", res.Remaining, tc.wantRemaining)
+			}
+			if res.RetryAfter != tc.wantRetry {
+				t.Errorf("RetryAfter = %v, want %v", res.RetryAfter, tc.wantRetry)
+			}
+			if res.Limit != limit.Burst {
+				t.Errorf("Limit = %d, want %d", res.Limit, limit.Burst)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 1, Period: time.Minute}
+
+	if res, _ := store.Take(context.Background(), "a", limit); !res.Allowed {
+		t.Fatal("first request for a was limited")
+	}
+	if res, _ := store.Take(context.Background(), "a", limit); res.Allowed {
+		t.Fatal("second request for a was allowed")
+	}
+	if res, _ := store.Take(context.Background(), "b", limit); !res.Allowed {
+		t.Fatal("first request for b was limited")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	limit := Limit{Burst: 2, Period: time.Second}
+
+	store.Take(context.Background(), "idle", limit)
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "active", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := store.buckets["active"]; !ok {
+		t.Error("active bucket was swept")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "10/1m", want: Limit{Burst: 10, Period: time.Minute}},
+		{value: "0/1s", want: Limit{Burst: 0, Period: time.Second}},
+		{value: "10", wantErr: true},
+		{value: "ten/1m", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "10/minute", wantErr: true},
+		{value: "10/0s", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseLimit(tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ParseLimit() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
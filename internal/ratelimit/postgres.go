@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// instance shares them.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take refills the bucket and takes a token in a single statement, so
+// concurrent requests to different instances can't both take the last
+// token. Time is measured with the database clock.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Burst),
+		Rate:  limit.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, row.Tokens, row.Allowed), nil
+}
+
+// Prune deletes buckets that haven't been used for longer than idle. A
+// bucket idle for its limit's period is full, so pass the longest period
+// in use.
+func (s *PostgresStore) Prune(ctx context.Context, idle time.Duration) (int64, error) {
+	return s.db.DeleteRateLimitBucketsBefore(ctx, time.Now().Add(-idle))
+}
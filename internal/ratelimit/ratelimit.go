@@ -0,0 +1,100 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// bucket storage.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled evenly over Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits written as "count/period", like "10/1m".
+func ParseLimit(value string) (Limit, error) {
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, want count/period like 10/1m", value)
+	}
+
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("invalid count in limit %q", value)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", value)
+	}
+
+	return Limit{Burst: burst, Period: d}, nil
+}
+
+// Disabled reports whether the limit lets every request through.
+func (l Limit) Disabled() bool {
+	return l.Burst == 0
+}
+
+// Scale multiplies the number of requests allowed per period.
+func (l Limit) Scale(factor int) Limit {
+	return Limit{Burst: l.Burst * factor, Period: l.Period}
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// Result describes the state of a bucket after taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Stores shared between instances, like the
+// Postgres store, enforce a limit across all of them.
+type Store interface {
+	// Take removes a token from the bucket for key if it has one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult builds the Result for a bucket left with tokens.
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+// refill returns the tokens in a bucket that had tokens elapsed ago.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.rate())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const subscriberBuffer = 64
+
+// Event is a change pushed to stream subscribers. ID is monotonically
+// increasing and is what clients send back as Last-Event-ID.
+type Event struct {
+	ID       int64
+	Type     string
+	AuthorID uuid.UUID
+	Data     []byte
+}
+
+type Subscription struct {
+	C <-chan Event
+	c chan Event
+}
+
+// Broker fans events out to subscribers within a single process.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe registers a new subscriber. Its channel is closed when the
+// subscriber falls too far behind or the broker is closed.
+func (b *Broker) Subscribe() *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// Publish sends the event to every subscriber without blocking. Subscribers
+// whose buffer is full are dropped so one slow client can't stall the rest;
+// they can reconnect with Last-Event-ID to catch up.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		select {
+		case sub.c <- e:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Close disconnects all subscribers and rejects new ones.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker()
+	sub1 := b.Subscribe()
+	sub2 := b.Subscribe()
+
+	event := Event{ID: 1, Type: "chirp.created", AuthorID: uuid.New(), Data: []byte(`{}`)}
+	b.Publish(event)
+
+	for i, sub := range []*Subscription{sub1, sub2} {
+		got, ok := <-sub.C
+		if !ok {
+			t.Fatalf("subscriber %d: channel closed", i)
+		}
+		if got.ID != event.ID {
+			t.Errorf("subscriber %d: expected event %d, got %d", i, event.ID, got.ID)
+		}
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe()
+	b.Unsubscribe(sub)
+	b.Publish(Event{ID: 1})
+
+	if _, ok := <-sub.C; ok {
+		t.Errorf("expected channel to be closed")
+	}
+
+	// Unsubscribing twice must not panic
+	b.Unsubscribe(sub)
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	slow := b.Subscribe()
+
+	for i := range subscriberBuffer + 1 {
+		b.Publish(Event{ID: int64(i + 1)})
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("expected %d buffered events before disconnect, got %d", subscriberBuffer, received)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe()
+	b.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Errorf("expected channel to be closed")
+	}
+
+	late := b.Subscribe()
+	if _, ok := <-late.C; ok {
+		t.Errorf("expected subscription after close to be closed")
+	}
+}
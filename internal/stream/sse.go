@@ -0,0 +1,28 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteEvent writes e in the Server-Sent Events wire format.
+func WriteEvent(w io.Writer, e Event) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id: %d\n", e.ID)
+	fmt.Fprintf(&buf, "event: %s\n", e.Type)
+	for line := range bytes.SplitSeq(e.Data, []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteHeartbeat writes an SSE comment, which keeps idle connections open
+// through proxies without delivering an event to the client.
+func WriteHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err
+}
@@ -0,0 +1,37 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{
+			name:     "single line data",
+			event:    Event{ID: 7, Type: "chirp.created", Data: []byte(`{"body":"hi"}`)},
+			expected: "id: 7\nevent: chirp.created\ndata: {\"body\":\"hi\"}\n\n",
+		},
+		{
+			name:     "multi line data",
+			event:    Event{ID: 8, Type: "chirp.deleted", Data: []byte("a\nb")},
+			expected: "id: 8\nevent: chirp.deleted\ndata: a\ndata: b\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteEvent(&buf, tt.event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package stream
+
+// Window remembers the IDs of the most recent events sent to a client, so
+// an event that arrives twice is only sent once. Event IDs are assigned
+// when the event is written, not when it is committed, so an event may
+// arrive after one with a higher ID. Comparing against the highest ID
+// sent would drop it.
+type Window struct {
+	size int
+	ids  []int64
+	next int
+	seen map[int64]struct{}
+}
+
+// NewWindow returns a Window remembering the last size IDs.
+func NewWindow(size int) *Window {
+	return &Window{
+		size: size,
+		seen: map[int64]struct{}{},
+	}
+}
+
+// Add records id and reports whether it wasn't already in the window.
+func (w *Window) Add(id int64) bool {
+	if _, ok := w.seen[id]; ok {
+		return false
+	}
+
+	if len(w.ids) < w.size {
+		w.ids = append(w.ids, id)
+	} else {
+		delete(w.seen, w.ids[w.next])
+		w.ids[w.next] = id
+		w.next = (w.next + 1) % w.size
+	}
+	w.seen[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,42 @@
+package stream
+
+import "testing"
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		ids      []int64
+		expected []bool
+	}{
+		{
+			name:     "duplicates are rejected",
+			size:     4,
+			ids:      []int64{1, 2, 1, 2},
+			expected: []bool{true, true, false, false},
+		},
+		{
+			name:     "lower IDs arriving late are accepted",
+			size:     4,
+			ids:      []int64{5, 7, 6, 7},
+			expected: []bool{true, true, true, false},
+		},
+		{
+			name:     "old IDs are forgotten",
+			size:     2,
+			ids:      []int64{1, 2, 3, 1, 3},
+			expected: []bool{true, true, true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWindow(tt.size)
+			for i, id := range tt.ids {
+				if got := w.Add(id); got != tt.expected[i] {
+					t.Errorf("Add(%d) at %d: expected %v, got %v", id, i, tt.expected[i], got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "chirpy"
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. exporter is "otlp" (configured through the standard
+// OTEL_EXPORTER_OTLP_* variables), "stdout", or "none"/"" to disable
+// exporting. The returned function flushes and stops the provider.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for every request, continuing any trace
+// passed in the traceparent header. The span is named after the route by
+// SetRoute.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, serviceName)
+}
+
+// SetRoute renames the request's server span after the ServeMux pattern
+// that matched it. The ServeMux sets the pattern on the request it was
+// given, so call it with that request once the ServeMux returns. Any
+// middleware in between that replaces the request, for example with
+// WithContext, hides the pattern from handlers further out.
+func SetRoute(r *http.Request) {
+	if r.Pattern == "" {
+		return
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	span.SetName(r.Pattern)
+	span.SetAttributes(attribute.String("http.route", r.Pattern))
+}
+
+// Transport propagates the current trace to outgoing requests.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
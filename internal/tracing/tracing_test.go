@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type ctxKey struct{}
+
+func TestSetRoute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {})
+
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		SetRoute(r)
+	})
+	// Like the request ID middleware, replace the request between the
+	// span and the ServeMux
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, "id")))
+	}))
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedName  string
+		expectedRoute string
+	}{
+		{
+			name:          "pattern route",
+			path:          "/api/chirps/0190b0a4-0000-7000-8000-000000000000",
+			expectedName:  "GET /api/chirps/{chirpID}",
+			expectedRoute: "GET /api/chirps/{chirpID}",
+		},
+		{
+			name:          "unmatched path",
+			path:          "/nowhere",
+			expectedName:  serviceName,
+			expectedRoute: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			if spans[0].Name() != tt.expectedName {
+				t.Errorf("expected span name %q, got %q", tt.expectedName, spans[0].Name())
+			}
+
+			route := ""
+			for _, attr := range spans[0].Attributes() {
+				if attr.Key == attribute.Key("http.route") {
+					route = attr.Value.AsString()
+				}
+			}
+			if route != tt.expectedRoute {
+				t.Errorf("expected http.route %q, got %q", tt.expectedRoute, route)
+			}
+		})
+	}
+}
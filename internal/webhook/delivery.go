@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxAttempts is the number of delivery attempts before a delivery is
+	// marked as failed.
+	MaxAttempts = 8
+
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Delivery is a single signed POST of an event payload to an endpoint.
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  []byte
+	Payload []byte
+}
+
+// NewSecret generates a random signing secret for a new endpoint.
+func NewSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return "whsec_" + hex.EncodeToString(secret)
+}
+
+// Send posts the payload to the delivery URL, signed with the endpoint
+// secret. It returns the response status code, which is zero when no
+// response was received, and an error for anything other than a 2xx.
+func Send(ctx context.Context, client *http.Client, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set("Chirpy-Event", d.Event)
+	req.Header.Set("Chirpy-Delivery", d.ID)
+	req.Header.Set("Chirpy-Signature", SignatureHeader(d.Secret, time.Now(), d.Payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Backoff returns how long to wait before retrying after the given number
+// of failed attempts. It doubles from 30 seconds and is capped at 6 hours.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+
+	backoff := baseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return backoff
+}
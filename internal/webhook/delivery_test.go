@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	secret := []byte("endpoint secret")
+	payload := []byte(`{"event":"chirp.created","data":{"body":"hello"}}`)
+
+	tests := []struct {
+		name           string
+		responseStatus int
+		expectedStatus int
+		expectError    bool
+	}{
+		{
+			name:           "accepted delivery",
+			responseStatus: http.StatusOK,
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:           "no content is a success",
+			responseStatus: http.StatusNoContent,
+			expectedStatus: http.StatusNoContent,
+			expectError:    false,
+		},
+		{
+			name:           "receiver error",
+			responseStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusInternalServerError,
+			expectError:    true,
+		},
+		{
+			name:           "redirects are not followed as success",
+			responseStatus: http.StatusMovedPermanently,
+			expectedStatus: http.StatusMovedPermanently,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read body: %v", err)
+				}
+
+				if r.Header.Get("Chirpy-Event") != "chirp.created" {
+					t.Errorf("unexpected event header %q", r.Header.Get("Chirpy-Event"))
+				}
+				if r.Header.Get("Chirpy-Delivery") != "delivery-1" {
+					t.Errorf("unexpected delivery header %q", r.Header.Get("Chirpy-Delivery"))
+				}
+
+				err = Verify(r.Header.Get("Chirpy-Signature"), body, [][]byte{secret}, time.Minute, time.Now())
+				if err != nil {
+					t.Errorf("signature did not verify: %v", err)
+				}
+
+				w.WriteHeader(tt.responseStatus)
+			}))
+			defer server.Close()
+
+			client := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+
+			status, err := Send(context.Background(), client, Delivery{
+				ID:      "delivery-1",
+				Event:   "chirp.created",
+				URL:     server.URL,
+				Secret:  secret,
+				Payload: payload,
+			})
+
+			if tt.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	status, err := Send(context.Background(), http.DefaultClient, Delivery{
+		ID:      "delivery-1",
+		Event:   "chirp.created",
+		URL:     url,
+		Secret:  []byte("secret"),
+		Payload: []byte(`{}`),
+	})
+	if err == nil {
+		t.Errorf("expected error but got none")
+	}
+	if status != 0 {
+		t.Errorf("expected status 0, got %d", status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: 0},
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 3, expected: 2 * time.Minute},
+		{attempts: 8, expected: 64 * time.Minute},
+		{attempts: 20, expected: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.expected {
+			t.Errorf("Backoff(%d) = %s, expected %s", tt.attempts, got, tt.expected)
+		}
+	}
+}
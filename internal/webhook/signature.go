@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature header")
+	ErrInvalidSignature = errors.New("bad signature header")
+	ErrTimestamp        = errors.New("timestamp outside tolerance")
+	ErrNoMatch          = errors.New("no matching signature")
+)
+
+// Sign computes the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader builds a header value of the form "t=<unix>,v1=<hex>".
+func SignatureHeader(secret []byte, timestamp time.Time, body []byte) string {
+	t := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", t, Sign(secret, t, body))
+}
+
+// Verify checks a signature header against the body. The header may carry
+// several v1 signatures and any of the secrets may match, which allows
+// secrets to be rotated without downtime.
+func Verify(header string, body []byte, secrets [][]byte, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+
+	var timestamp int64
+	var signatures [][]byte
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrTimestamp
+	}
+
+	for _, secret := range secrets {
+		expected, _ := hex.DecodeString(Sign(secret, timestamp, body))
+		for _, sig := range signatures {
+			if hmac.Equal(expected, sig) {
+				return nil
+			}
+		}
+	}
+
+	return ErrNoMatch
+}
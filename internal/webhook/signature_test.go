@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	oldSecret := []byte("old secret")
+	newSecret := []byte("new secret")
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name        string
+		header      string
+		body        []byte
+		secrets     [][]byte
+		expectedErr error
+	}{
+		{
+			name:    "valid signature",
+			header:  SignatureHeader(newSecret, now, body),
+			body:    body,
+			secrets: [][]byte{newSecret},
+		},
+		{
+			name:    "signed with rotated secret",
+			header:  SignatureHeader(oldSecret, now, body),
+			body:    body,
+			secrets: [][]byte{newSecret, oldSecret},
+		},
+		{
+			name: "multiple signatures in header",
+			header: fmt.Sprintf("t=%d,v1=%s,v1=%s", now.Unix(),
+				Sign(oldSecret, now.Unix(), body), Sign(newSecret, now.Unix(), body)),
+			body:    body,
+			secrets: [][]byte{newSecret},
+		},
+		{
+			name:        "missing header",
+			header:      "",
+			body:        body,
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrMissingSignature,
+		},
+		{
+			name:        "malformed header",
+			header:      "garbage",
+			body:        body,
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "missing timestamp",
+			header:      "v1=" + Sign(newSecret, now.Unix(), body),
+			body:        body,
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "expired timestamp",
+			header:      SignatureHeader(newSecret, now.Add(-10*time.Minute), body),
+			body:        body,
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrTimestamp,
+		},
+		{
+			name:        "timestamp in the future",
+			header:      SignatureHeader(newSecret, now.Add(10*time.Minute), body),
+			body:        body,
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrTimestamp,
+		},
+		{
+			name:        "tampered body",
+			header:      SignatureHeader(newSecret, now, body),
+			body:        []byte(`{"id":"evt_1","event":"user.downgraded"}`),
+			secrets:     [][]byte{newSecret},
+			expectedErr: ErrNoMatch,
+		},
+		{
+			name:        "unknown secret",
+			header:      SignatureHeader([]byte("someone else"), now, body),
+			body:        body,
+			secrets:     [][]byte{newSecret, oldSecret},
+			expectedErr: ErrNoMatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.header, tt.body, tt.secrets, tolerance, now)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Verify() error = %v, expected %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
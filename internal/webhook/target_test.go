@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{addr: "93.184.216.34", expected: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", expected: true},
+		{addr: "127.0.0.1", expected: false},
+		{addr: "::1", expected: false},
+		{addr: "10.1.2.3", expected: false},
+		{addr: "172.16.0.1", expected: false},
+		{addr: "192.168.1.1", expected: false},
+		{addr: "169.254.169.254", expected: false},
+		{addr: "fe80::1", expected: false},
+		{addr: "fd00:ec2::254", expected: false},
+		{addr: "0.0.0.0", expected: false},
+		{addr: "100.64.0.1", expected: false},
+		{addr: "224.0.0.1", expected: false},
+		{addr: "255.255.255.255", expected: false},
+		{addr: "::ffff:127.0.0.1", expected: false},
+		{addr: "64:ff9b::a9fe:a9fe", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublic(netip.MustParseAddr(tt.addr)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		expectError bool
+	}{
+		{
+			name:        "public address",
+			url:         "https://93.184.216.34/hooks",
+			expectError: false,
+		},
+		{
+			name:        "loopback",
+			url:         "http://127.0.0.1:8080/hooks",
+			expectError: true,
+		},
+		{
+			name:        "metadata service",
+			url:         "http://169.254.169.254/latest/meta-data/",
+			expectError: true,
+		},
+		{
+			name:        "private IPv6",
+			url:         "http://[fd00::1]/hooks",
+			expectError: true,
+		},
+		{
+			name:        "name resolving to loopback",
+			url:         "http://localhost/hooks",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckURL(context.Background(), net.DefaultResolver, tt.url)
+			if tt.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTransportRefusesNonPublic(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport()}
+	status, err := Send(context.Background(), client, Delivery{
+		ID:      "delivery-1",
+		Event:   "chirp.created",
+		URL:     server.URL,
+		Secret:  []byte("secret"),
+		Payload: []byte(`{}`),
+	})
+	if !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("expected ErrNonPublicAddress, got %v", err)
+	}
+	if status != 0 {
+		t.Errorf("expected status 0, got %d", status)
+	}
+}
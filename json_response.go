@@ -1,11 +1,70 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Error codes are part of the API, clients match on them instead of the
+// human readable detail. Add new codes rather than changing what an
+// existing one means.
+const (
+	codeInvalidBody          = "invalid_body"
+	codeBodyTooLarge         = "body_too_large"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeValidationFailed     = "validation_failed"
+	codeInvalidID            = "invalid_id"
+	codeUnauthorized         = "unauthorized"
+	codeInvalidCredentials   = "invalid_credentials"
+	codeInvalidToken         = "invalid_token"
+	codeTokenExpired         = "token_expired"
+	codeTokenRevoked         = "token_revoked"
+	codeInvalidSignature     = "invalid_signature"
+	codeForbidden            = "forbidden"
+	codeAccountSuspended     = "account_suspended"
+	codeAccountBanned        = "account_banned"
+	codeFeatureUnavailable   = "feature_unavailable"
+	codeCannotFollowSelf     = "cannot_follow_self"
+	codeCannotBlockSelf      = "cannot_block_self"
+	codeCannotMuteSelf       = "cannot_mute_self"
+	codeBlocked              = "blocked"
+	codeNotFound             = "not_found"
+	codeGone                 = "gone"
+	codeConflict             = "conflict"
+	codeRateLimited          = "rate_limited"
+	codeInternal             = "internal_error"
 )
 
+// problem is an RFC 7807 problem details response. Code, Errors and
+// Account are extension members.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+
+	Account *accountRestriction `json:"account,omitempty"`
+}
+
+// fieldError describes why a single request field was rejected.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func respondJSON(w http.ResponseWriter, statusCode int, resBody any) {
 	data, err := json.Marshal(resBody)
 	if err != nil {
@@ -18,16 +77,114 @@ func respondJSON(w http.ResponseWriter, statusCode int, resBody any) {
 	w.Write(data)
 }
 
-func respondJSONError(w http.ResponseWriter, statusCode int, msg string, err error) {
-	type response struct {
-		Error string `json:"error"`
+// respondError logs err and sends a problem response. err is only logged,
+// the client gets the code and detail.
+func respondError(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string, err error) {
+	writeProblem(w, r, problem{
+		Status: statusCode,
+		Code:   code,
+		Detail: detail,
+	}, err)
+}
+
+// respondValidationError rejects a request with one entry per invalid
+// field.
+func respondValidationError(w http.ResponseWriter, r *http.Request, fields ...fieldError) {
+	writeProblem(w, r, problem{
+		Status: http.StatusBadRequest,
+		Code:   codeValidationFailed,
+		Detail: "the request contains invalid fields",
+		Errors: fields,
+	}, nil)
+}
+
+// respondDecodeError maps an error reading or decoding the request body to
+// a client error.
+func respondDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		respondError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "request body is too large", err)
+	case errors.Is(err, errTrailingData):
+		respondError(w, r, http.StatusBadRequest, codeInvalidBody, err.Error(), err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		respondValidationError(w, r, fieldError{
+			Field:   field,
+			Code:    "unknown",
+			Message: "is not a known field",
+		})
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		respondValidationError(w, r, fieldError{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: "must be " + jsonTypeName(typeErr.Type.Kind()),
+		})
+	case errors.Is(err, io.EOF):
+		respondError(w, r, http.StatusBadRequest, codeInvalidBody, "request body is empty", err)
+	default:
+		respondError(w, r, http.StatusBadRequest, codeInvalidBody, "request body is not valid JSON", err)
+	}
+}
+
+// respondLookupError answers a failed lookup of a single resource, a
+// missing row is a 404 and anything else is a server error.
+func respondLookupError(w http.ResponseWriter, r *http.Request, resource string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, codeNotFound, resource+" not found", err)
+		return
 	}
+	respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get "+resource, err)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem, err error) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = w.Header().Get(requestIDHeader)
 
+	level := slog.LevelWarn
+	if p.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	loggerFrom(r.Context()).Log(r.Context(), level, "request failed",
+		"handler", r.Pattern,
+		"status", p.Status,
+		"code", p.Code,
+		"message", p.Detail,
+		"error", err,
+	)
+
+	data, err := json.Marshal(p)
 	if err != nil {
-		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	respondJSON(w, statusCode, response{
-		Error: msg,
-	})
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	w.Write(data)
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a number"
+	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/auth"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type requestLogKey struct{}
+
+// requestLog is stored in the request context by middlewareRequestID.
+// Handlers fill in the user once they have authenticated the request so
+// every later log line for the request carries it.
+type requestLog struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	userID uuid.UUID
+}
+
+func newLogger(w io.Writer, level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl}))
+}
+
+// loggerFrom returns the request scoped logger, or the default logger
+// outside of a request.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return slog.Default()
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.userID != uuid.Nil {
+		return rl.logger.With("user_id", rl.userID)
+	}
+	return rl.logger
+}
+
+func setRequestUser(ctx context.Context, userID uuid.UUID) {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		rl.userID = userID
+		rl.mu.Unlock()
+	}
+}
+
+// validRequestID accepts IDs supplied by clients or proxies as long as they
+// are short and can't be used to inject anything into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return r <= ' ' || r > '~'
+	})
+}
+
+// middlewareRequestID honours an incoming X-Request-ID or generates one,
+// echoes it in the response and attaches a logger carrying it to the
+// request context.
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		rl := &requestLog{logger: logger}
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// middlewareAccessLog writes one log line per request once it completes.
+func middlewareAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		loggerFrom(r.Context()).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", r.Pattern,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// authenticate validates the request's bearer JWT and returns the user ID
+// it was issued for. Tokens of suspended or banned users are refused even
+// though they haven't expired. Send its errors with respondAuthError.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	setRequestUser(r.Context(), userID)
+
+	if err := cfg.checkAccount(r.Context(), userID); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, nil
+}
@@ -1,67 +1,358 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/Quak1/chirpy/internal/config"
 	"github.com/Quak1/chirpy/internal/database"
-	"github.com/joho/godotenv"
+	"github.com/Quak1/chirpy/internal/mail"
+	"github.com/Quak1/chirpy/internal/metrics"
+	"github.com/Quak1/chirpy/internal/ratelimit"
+	"github.com/Quak1/chirpy/internal/stream"
+	"github.com/Quak1/chirpy/internal/tracing"
 	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/Quak1/chirpy")
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
 	platform       string
 	tokenSecret    string
-	polkaKey       string
+	polkaSecrets   [][]byte
+	redFeatures    map[feature]bool
+	stream         *stream.Broker
+
+	rateLimiter      ratelimit.Store
+	rateLimits       map[string]ratelimit.Limit
+	trustProxy       bool
+	maxJSONBodyBytes int64
+	mailer           mail.Sender
+	migrator         *goose.Provider
+	readinessTimeout time.Duration
+	mediaDir         string
+	deletionGrace    time.Duration
+	chirpRetention   time.Duration
 }
 
 func main() {
-	godotenv.Load()
+	configPath := flag.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a YAML config file")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Parse()
+
+	conf, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(newLogger(os.Stdout, conf.LogLevel))
+
+	if *printConfig {
+		slog.Info("effective config", "config", conf)
+		return
+	}
+
+	if err := run(conf, flag.Args()); err != nil {
+		slog.Error("chirpy stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches to the subcommand named by the first argument, serving
+// the API when there is none.
+func run(conf config.Config, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		return serve(ctx, conf)
+
+	case "migrate":
+		db, err := openDB(ctx, conf)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runMigrate(ctx, db, args)
+
+	case "user", "chirp", "token":
+		db, err := openDB(ctx, conf)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+		cfg := &apiConfig{
+			db:     database.New(instrumentDB(db)),
+			dbConn: db,
+		}
+		switch command {
+		case "user":
+			return cfg.runUserCommand(ctx, args)
+		case "chirp":
+			return cfg.runChirpCommand(ctx, args)
+		default:
+			return cfg.runTokenCommand(ctx, args)
+		}
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// openDB connects to Postgres, waiting for it to come up.
+func openDB(ctx context.Context, conf config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", conf.DBURL)
+	if err != nil {
+		return nil, fmt.Errorf("error connection to db: %w", err)
+	}
+
+	if err := waitForDB(ctx, db, conf.DBConnectTimeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func serve(ctx context.Context, conf config.Config) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	slog.Info("loaded config", "config", conf)
+
+	shutdownTracing, err := tracing.Setup(ctx, conf.TracesExporter)
 	if err != nil {
-		log.Fatalf("error connection to db: %s", err)
+		return fmt.Errorf("error setting up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err := openDB(ctx, conf)
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	if conf.MigrateOnStart {
+		if err := migrateUp(ctx, migrator); err != nil {
+			return fmt.Errorf("error migrating database: %w", err)
+		}
+	}
+	if err := checkSchema(ctx, migrator); err != nil {
+		return fmt.Errorf("%w, run \"chirpy migrate up\" or set MIGRATE_ON_START", err)
+	}
+
+	redFeatures, err := parseFeatures(conf.RedFeatures)
+	if err != nil {
+		return fmt.Errorf("error reading CHIRPY_RED_FEATURES: %w", err)
+	}
+
+	rateLimits, err := parseRateLimits(conf.RateLimits)
+	if err != nil {
+		return fmt.Errorf("error reading RATE_LIMITS: %w", err)
+	}
+
 	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             database.New(db),
-		platform:       os.Getenv("PLATFORM"),
-		tokenSecret:    os.Getenv("TOKEN_SECRET"),
-		polkaKey:       os.Getenv("POLKA_KEY"),
+		fileserverHits:   atomic.Int32{},
+		db:               database.New(instrumentDB(db)),
+		dbConn:           db,
+		platform:         conf.Platform,
+		tokenSecret:      conf.TokenSecret,
+		polkaSecrets:     parseSecrets(conf.PolkaWebhookSecrets),
+		redFeatures:      redFeatures,
+		stream:           stream.NewBroker(),
+		rateLimiter:      ratelimit.NewMemoryStore(),
+		rateLimits:       rateLimits,
+		trustProxy:       conf.TrustProxy,
+		maxJSONBodyBytes: conf.Server.MaxJSONBodyBytes,
+		mailer:           mail.LogSender{},
+		migrator:         migrator,
+		readinessTimeout: conf.ReadinessTimeout,
+		mediaDir:         conf.MediaDir,
+		deletionGrace:    conf.AccountDeletionGrace,
+		chirpRetention:   conf.ChirpRetention,
+	}
+
+	if conf.SMTP.Addr != "" {
+		apiCfg.mailer = mail.SMTPSender{
+			Addr:     conf.SMTP.Addr,
+			From:     conf.SMTP.From,
+			Username: conf.SMTP.Username,
+			Password: conf.SMTP.Password,
+		}
+	}
+
+	var workers sync.WaitGroup
+	workers.Go(func() { apiCfg.runSubscriptionExpiry(ctx, time.Hour) })
+	workers.Go(func() { apiCfg.runWebhookDispatcher(ctx, 5*time.Second) })
+	workers.Go(func() { apiCfg.runChirpEventListener(ctx, conf.DBURL) })
+	workers.Go(func() { apiCfg.runAccountPurge(ctx, time.Hour) })
+	workers.Go(func() { apiCfg.runChirpPurge(ctx, time.Hour) })
+	workers.Go(func() { apiCfg.runChirpScheduler(ctx, 10*time.Second) })
+	if conf.RateLimitStore == "postgres" {
+		store := ratelimit.NewPostgresStore(apiCfg.db)
+		apiCfg.rateLimiter = store
+		workers.Go(func() { apiCfg.runRateLimitPrune(ctx, store, time.Hour) })
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	mux.HandleFunc("GET /livez", apiCfg.handlerLivez)
+	mux.HandleFunc("GET /readyz", apiCfg.handlerReadyz)
+	mux.HandleFunc("GET /api/healthz", apiCfg.handlerReadyz)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
+	mux.Handle("POST /api/users", apiCfg.rateLimit("create_user", apiCfg.handlerCreateUser))
+	mux.Handle("POST /api/login", apiCfg.rateLimit("login", apiCfg.handlerLogin))
+	mux.Handle("POST /api/chirps", apiCfg.rateLimit("create_chirp", apiCfg.handlerCreateChirp))
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetAllChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken)
+	mux.HandleFunc("GET /api/stream", apiCfg.handlerStream)
+	mux.Handle("POST /api/refresh", apiCfg.rateLimit("refresh", apiCfg.handlerRefreshToken))
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeRefreshToken)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("PATCH /api/users/me", apiCfg.handlerUpdateMe)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteMe)
+	mux.Handle("GET /api/users/me/export", apiCfg.rateLimit("export_data", apiCfg.handlerExportMe))
+	mux.HandleFunc("POST /api/users/confirm-email", apiCfg.handlerConfirmEmail)
+	mux.HandleFunc("PUT /api/users/me/avatar", apiCfg.handlerUploadAvatar)
+	mux.HandleFunc("DELETE /api/users/me/avatar", apiCfg.handlerDeleteAvatar)
+	mux.HandleFunc("GET /api/users/{handle}", apiCfg.handlerGetProfile)
+	mux.HandleFunc("POST /api/users/{handle}/follow", apiCfg.handlerFollow)
+	mux.HandleFunc("DELETE /api/users/{handle}/follow", apiCfg.handlerUnfollow)
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.handlerGetBlocks)
+	mux.HandleFunc("POST /api/users/{handle}/block", apiCfg.handlerBlock)
+	mux.HandleFunc("DELETE /api/users/{handle}/block", apiCfg.handlerUnblock)
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.handlerGetMutes)
+	mux.HandleFunc("POST /api/users/{handle}/mute", apiCfg.handlerMute)
+	mux.HandleFunc("DELETE /api/users/{handle}/mute", apiCfg.handlerUnmute)
+	mux.HandleFunc("GET /media/avatars/{name}", apiCfg.handlerAvatar)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerUpdateChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDelteChirp)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeToChirpyRed)
+	mux.Handle("POST /api/chirps/{chirpID}/report", apiCfg.rateLimit("create_report", apiCfg.handlerReportChirp))
+	mux.HandleFunc("GET /api/chirps/scheduled", apiCfg.handlerGetScheduledChirps)
+	mux.HandleFunc("PUT /api/chirps/scheduled/{scheduledID}", apiCfg.handlerUpdateScheduledChirp)
+	mux.HandleFunc("DELETE /api/chirps/scheduled/{scheduledID}", apiCfg.handlerCancelScheduledChirp)
+	mux.HandleFunc("POST /api/drafts", apiCfg.handlerCreateDraft)
+	mux.HandleFunc("GET /api/drafts", apiCfg.handlerGetDrafts)
+	mux.HandleFunc("GET /api/drafts/{draftID}", apiCfg.handlerGetDraft)
+	mux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.handlerUpdateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.handlerDeleteDraft)
+	mux.Handle("POST /api/drafts/{draftID}/publish", apiCfg.rateLimit("create_chirp", apiCfg.handlerPublishDraft))
+	mux.HandleFunc("GET /api/moderation/reports", apiCfg.handlerGetReports)
+	mux.HandleFunc("POST /api/moderation/reports/{reportID}/resolve", apiCfg.handlerResolveReport)
+	mux.HandleFunc("GET /api/moderation/actions", apiCfg.handlerGetModerationActions)
+	mux.HandleFunc("POST /api/moderation/chirps/{chirpID}/restore", apiCfg.handlerRestoreChirp)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhooks)
+	mux.Handle("POST /api/webhooks", apiCfg.rateLimit("create_webhook", apiCfg.handlerCreateWebhook))
+	mux.HandleFunc("GET /api/webhooks", apiCfg.handlerGetWebhooks)
+	mux.HandleFunc("DELETE /api/webhooks/{webhookID}", apiCfg.handlerDeleteWebhook)
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries", apiCfg.handlerGetWebhookDeliveries)
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries/{deliveryID}", apiCfg.handlerGetWebhookDelivery)
+	mux.HandleFunc("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", apiCfg.handlerRedeliverWebhook)
+
+	handler := tracing.Middleware(middlewareRequestID(middlewareAccessLog(middlewareInstrument(mux))))
+	server := &http.Server{
+		Addr:              conf.Server.Addr,
+		Handler:           http.MaxBytesHandler(handler, conf.Server.MaxBodyBytes),
+		ReadTimeout:       conf.Server.ReadTimeout,
+		ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
+		WriteTimeout:      conf.Server.WriteTimeout,
+		IdleTimeout:       conf.Server.IdleTimeout,
+		MaxHeaderBytes:    conf.Server.MaxHeaderBytes,
+	}
+	// Streams only end when their subscription is closed, so close them all
+	// or Shutdown would wait for the full timeout
+	server.RegisterOnShutdown(apiCfg.stream.Close)
 
-	server := http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	// Metrics get their own listener, they aren't meant for API clients
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", metrics.Handler())
+	metricsServer := &http.Server{
+		Addr:              conf.Server.MetricsAddr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
 	}
+	defer metricsServer.Close()
 
-	server.ListenAndServe()
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("server listening", "addr", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+	go func() {
+		slog.Info("metrics listening", "addr", metricsServer.Addr)
+		serveErr <- metricsServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stop()
+		workers.Wait()
+		return fmt.Errorf("listener failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", conf.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+	defer cancel()
+
+	err = errors.Join(server.Shutdown(shutdownCtx), metricsServer.Shutdown(shutdownCtx))
+	workers.Wait()
+	if err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+
+	slog.Info("server stopped")
+	return nil
+}
+
+// beginTx starts a transaction and returns Queries bound to it. Unlike
+// Queries.WithTx, the transaction's queries are instrumented.
+func (cfg *apiConfig) beginTx(ctx context.Context) (*sql.Tx, *database.Queries, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, database.New(instrumentDB(tx)), nil
+}
+
+// instrumentDB wraps a connection or transaction with query metrics and
+// tracing.
+func instrumentDB(db database.DBTX) database.DBTX {
+	return tracing.InstrumentDB(metrics.InstrumentDB(db))
+}
+
+// parseSecrets converts the configured secrets to keys. More than one
+// secret can be active while a secret is being rotated.
+func parseSecrets(values []string) [][]byte {
+	secrets := [][]byte{}
+	for _, secret := range values {
+		secrets = append(secrets, []byte(secret))
+	}
+	return secrets
 }
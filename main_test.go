@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/auth"
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/mail"
+	"github.com/Quak1/chirpy/internal/ratelimit"
+	"github.com/Quak1/chirpy/internal/stream"
+)
+
+// testDBURLEnv names the Postgres database the handler tests run against.
+// Tests that need it are skipped when it isn't set. Every table is
+// emptied before each test, never point it at a database you care about.
+const testDBURLEnv = "CHIRPY_TEST_DB_URL"
+
+const (
+	testTokenSecret = "test-secret"
+	testPassword    = "correct horse battery staple"
+)
+
+// newTestConfig returns an apiConfig backed by an empty, fully migrated
+// test database.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		t.Skipf("%s isn't set", testDBURLEnv)
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		t.Fatalf("failed to create migrator: %v", err)
+	}
+	if err := migrateUp(ctx, migrator); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	truncateTables(t, db)
+
+	redFeatures, err := parseFeatures(nil)
+	if err != nil {
+		t.Fatalf("failed to parse features: %v", err)
+	}
+
+	return &apiConfig{
+		db:               database.New(instrumentDB(db)),
+		dbConn:           db,
+		platform:         "dev",
+		tokenSecret:      testTokenSecret,
+		redFeatures:      redFeatures,
+		stream:           stream.NewBroker(),
+		rateLimiter:      ratelimit.NewMemoryStore(),
+		rateLimits:       map[string]ratelimit.Limit{},
+		maxJSONBodyBytes: 1 << 20,
+		mailer:           &recordingSender{},
+		migrator:         migrator,
+		readinessTimeout: time.Second,
+		mediaDir:         t.TempDir(),
+		deletionGrace:    24 * time.Hour,
+		chirpRetention:   24 * time.Hour,
+	}
+}
+
+// truncateTables empties every table but goose's own.
+func truncateTables(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT tablename FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'goose_db_version'`)
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("failed to list tables: %v", err)
+		}
+		tables = append(tables, fmt.Sprintf("%q", table))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+
+	if _, err := db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " CASCADE"); err != nil {
+		t.Fatalf("failed to truncate tables: %v", err)
+	}
+}
+
+// testUser is a user created for a test along with an access token.
+type testUser struct {
+	database.User
+	token string
+}
+
+// createTestUser creates an active user with the given handle and
+// testPassword as password.
+func createTestUser(t *testing.T, cfg *apiConfig, handle string) testUser {
+	t.Helper()
+
+	hashedPassword, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	ctx := context.Background()
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		HashedPassword: hashedPassword,
+		Email:          handle + "@example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err = cfg.db.UpdateUserProfile(ctx, database.UpdateUserProfileParams{
+		ID:     user.ID,
+		Handle: sql.NullString{String: handle, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to set handle: %v", err)
+	}
+
+	token, err := auth.MakeJWT(user.ID, testTokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	return testUser{User: user, token: token}
+}
+
+// newTestRequest builds a request as user, who may be nil, with body
+// encoded as JSON unless it is nil. pathValues are name, value pairs.
+func newTestRequest(t *testing.T, method, target string, user *testUser, body any, pathValues ...string) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	r := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if user != nil {
+		r.Header.Set("Authorization", "Bearer "+user.token)
+	}
+	for i := 0; i+1 < len(pathValues); i += 2 {
+		r.SetPathValue(pathValues[i], pathValues[i+1])
+	}
+	return r
+}
+
+// serveTest runs handler on r and fails the test unless it responds with
+// the expected status. The response body is decoded into res unless it is
+// nil.
+func serveTest(t *testing.T, handler http.HandlerFunc, r *http.Request, expected int, res any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	if rec.Code != expected {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", r.Method, r.URL, expected, rec.Code, rec.Body)
+	}
+	if res != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return rec
+}
+
+// recordingSender keeps the messages it is asked to send, or fails with
+// err when it is set.
+type recordingSender struct {
+	messages []mail.Message
+	err      error
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg mail.Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
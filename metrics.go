@@ -3,15 +3,73 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/metrics"
+	"github.com/Quak1/chirpy/internal/tracing"
 )
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cfg.fileserverHits.Add(1)
+		metrics.FileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
 
+// statusRecorder captures the status code written by a handler. Unwrap lets
+// http.ResponseController reach the underlying writer, which streaming
+// handlers rely on for flushing.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// middlewareInstrument records request counts and latency labelled by the
+// ServeMux pattern that matched, so /api/chirps/{chirpID} is one series
+// rather than one per chirp, and names the trace span after it. It must
+// wrap the ServeMux directly to see the pattern.
+func middlewareInstrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+		tracing.SetRoute(r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Write(fmt.Appendf(nil, `
 <html>
@@ -32,7 +90,7 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	cfg.fileserverHits.Store(0)
 
 	if err := cfg.db.DeleteUsers(r.Context()); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to reset db", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to reset db", err)
 		return
 	}
 
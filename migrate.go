@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Quak1/chirpy/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// newMigrator returns a goose provider for the migrations embedded in the
+// binary. Migrations hold a Postgres advisory lock so instances started
+// together with MIGRATE_ON_START don't race each other.
+func newMigrator(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// checkSchema returns an error when the database is missing migrations
+// that this binary depends on. A newer schema is fine, it happens while an
+// older binary is still running during a deploy.
+func checkSchema(ctx context.Context, migrator *goose.Provider) error {
+	current, target, err := migrator.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't read schema version: %w", err)
+	}
+	if current < target {
+		return fmt.Errorf("database schema is at version %d, want %d", current, target)
+	}
+	return nil
+}
+
+func migrateUp(ctx context.Context, migrator *goose.Provider) error {
+	results, err := migrator.Up(ctx)
+	for _, res := range results {
+		slog.Info("applied migration", "version", res.Source.Version, "duration", res.Duration.String())
+	}
+	return err
+}
+
+// runMigrate implements "chirpy migrate up|down|status".
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: chirpy migrate up|down|status")
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, migrator)
+
+	case "down":
+		res, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("rolled back migration", "version", res.Source.Version, "duration", res.Duration.String())
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down or status", args[0])
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	reportOpen      = "open"
+	reportActioned  = "actioned"
+	reportDismissed = "dismissed"
+
+	actionHideChirp     = "hide_chirp"
+	actionSuspendUser   = "suspend_user"
+	actionBanUser       = "ban_user"
+	actionReinstateUser = "reinstate_user"
+	actionRestoreChirp  = "restore_chirp"
+	actionDismiss       = "dismiss"
+
+	moderationLogLimit = 100
+)
+
+type Report struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ChirpID    uuid.UUID  `json:"chirp_id"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *uuid.UUID `json:"resolved_by,omitempty"`
+}
+
+func newReport(report database.Report) Report {
+	res := Report{
+		ID:         report.ID,
+		CreatedAt:  report.CreatedAt,
+		ChirpID:    report.ChirpID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		ResolvedAt: timePtr(report.ResolvedAt),
+	}
+	if report.ResolvedBy.Valid {
+		res.ResolvedBy = &report.ResolvedBy.UUID
+	}
+	return res
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorID  *uuid.UUID `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportID     *uuid.UUID `json:"report_id,omitempty"`
+	ChirpID      *uuid.UUID `json:"chirp_id,omitempty"`
+	TargetUserID *uuid.UUID `json:"target_user_id,omitempty"`
+	Reason       string     `json:"reason"`
+}
+
+func newModerationAction(action database.ModerationAction) ModerationAction {
+	return ModerationAction{
+		ID:           action.ID,
+		CreatedAt:    action.CreatedAt,
+		ModeratorID:  uuidPtr(action.ModeratorID),
+		Action:       action.Action,
+		ReportID:     uuidPtr(action.ReportID),
+		ChirpID:      uuidPtr(action.ChirpID),
+		TargetUserID: uuidPtr(action.TargetUserID),
+		Reason:       action.Reason,
+	}
+}
+
+// uuidPtr returns the ID in a nullable column, or nil for NULL.
+func uuidPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// requireAdmin authenticates the request and checks the user is an admin.
+// On failure it writes the error response and returns false.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return database.User{}, false
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return database.User{}, false
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
+		return database.User{}, false
+	}
+
+	if user.Role != roleAdmin {
+		respondError(w, r, http.StatusForbidden, codeForbidden, "admin role required", nil)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason  string `json:"reason" validate:"required,oneof=spam harassment hate violence misinformation other"`
+		Details string `json:"details" validate:"max=500"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	chirp, ok := cfg.lookupChirp(w, r)
+	if !ok {
+		return
+	}
+	if chirp.HiddenAt.Valid {
+		respondLookupError(w, r, "chirp", sql.ErrNoRows)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	report, err := cfg.db.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: userID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	if isUniqueViolation(err) {
+		respondError(w, r, http.StatusConflict, codeConflict, "you already reported this chirp", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to report chirp", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, newReport(report))
+}
+
+// handlerGetReports returns the moderation queue, the open reports
+// oldest first.
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	type queueItem struct {
+		Report
+		ChirpBody   string    `json:"chirp_body"`
+		AuthorID    uuid.UUID `json:"author_id"`
+		OpenReports int64     `json:"open_reports"`
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	reports, err := cfg.db.GetOpenReports(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get reports", err)
+		return
+	}
+
+	queue := make([]queueItem, len(reports))
+	for i, report := range reports {
+		queue[i] = queueItem{
+			Report: newReport(database.Report{
+				ID:         report.ID,
+				CreatedAt:  report.CreatedAt,
+				ChirpID:    report.ChirpID,
+				ReporterID: report.ReporterID,
+				Reason:     report.Reason,
+				Details:    report.Details,
+				Status:     report.Status,
+				ResolvedAt: report.ResolvedAt,
+				ResolvedBy: report.ResolvedBy,
+			}),
+			ChirpBody:   report.ChirpBody,
+			AuthorID:    report.AuthorID,
+			OpenReports: report.OpenReports,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, queue)
+}
+
+// handlerResolveReport applies a moderator's decision on a report. The
+// decision is about the chirp, so it resolves every open report on it,
+// and it is recorded in the audit trail. When moderators decide on the
+// same chirp at once, only the first decision is applied.
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action      string `json:"action" validate:"required,oneof=hide_chirp suspend_user ban_user dismiss"`
+		Reason      string `json:"reason" validate:"max=500"`
+		SuspendDays int    `json:"suspend_days" validate:"required_if=Action suspend_user,omitempty,min=1,max=3650"`
+	}
+
+	moderator, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid report id", err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	report, err := cfg.db.GetReport(r.Context(), reportID)
+	if err != nil {
+		respondLookupError(w, r, "report", err)
+		return
+	}
+	if report.Status != reportOpen {
+		respondError(w, r, http.StatusConflict, codeConflict, "report has already been resolved", nil)
+		return
+	}
+
+	// The author may have deleted the chirp since, the report still needs
+	// an answer
+	chirp, err := cfg.db.GetChirpIncludingDeleted(r.Context(), report.ChirpID)
+	if err != nil {
+		respondLookupError(w, r, "chirp", err)
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to resolve report", err)
+		return
+	}
+	defer tx.Rollback()
+
+	status := reportActioned
+	if params.Action == actionDismiss {
+		status = reportDismissed
+	}
+
+	// Resolving first locks the chirp's open reports. A moderator resolving
+	// any of them at the same time waits here, then finds this report no
+	// longer open and acts on nothing.
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+	resolved, err := qtx.ResolveChirpReports(r.Context(), database.ResolveChirpReportsParams{
+		ChirpID:    chirp.ID,
+		Status:     status,
+		ResolvedBy: moderatorID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to resolve report", err)
+		return
+	}
+	if !slices.Contains(resolved, report.ID) {
+		respondError(w, r, http.StatusConflict, codeConflict, "report has already been resolved", nil)
+		return
+	}
+
+	switch params.Action {
+	case actionHideChirp:
+		chirp, err = qtx.HideChirp(r.Context(), chirp.ID)
+		if err == nil {
+			err = enqueueEvent(r.Context(), qtx, chirp.UserID, eventChirpDeleted, newChirp(chirp))
+		}
+
+	case actionSuspendUser:
+		until := time.Now().AddDate(0, 0, params.SuspendDays)
+		_, _, err = setAccountStatus(r.Context(), qtx, chirp.UserID, userStatusSuspended, until, params.Reason)
+
+	case actionBanUser:
+		_, _, err = setAccountStatus(r.Context(), qtx, chirp.UserID, userStatusBanned, time.Time{}, params.Reason)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to resolve report", err)
+		return
+	}
+
+	action, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  moderatorID,
+		Action:       params.Action,
+		ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		Reason:       params.Reason,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to resolve report", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to resolve report", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newModerationAction(action))
+}
+
+// handlerRestoreChirp undoes the soft delete of a chirp that hasn't been
+// purged yet. It is recorded in the audit trail like any other decision.
+func (cfg *apiConfig) handlerRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+
+	moderator, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid chirp id", err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to restore chirp", err)
+		return
+	}
+	defer tx.Rollback()
+
+	chirp, err := qtx.RestoreChirp(r.Context(), chirpID)
+	if err != nil {
+		respondLookupError(w, r, "deleted chirp", err)
+		return
+	}
+
+	// A hidden chirp stays out of view, restoring it only undoes the delete
+	if !chirp.HiddenAt.Valid {
+		if err := enqueueEvent(r.Context(), qtx, chirp.UserID, eventChirpCreated, newChirp(chirp)); err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to restore chirp", err)
+			return
+		}
+	}
+
+	_, err = qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		Action:       actionRestoreChirp,
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		Reason:       params.Reason,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to restore chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to restore chirp", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newChirp(chirp))
+}
+
+// handlerGetModerationActions returns the latest moderator decisions,
+// newest first.
+func (cfg *apiConfig) handlerGetModerationActions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	actions, err := cfg.db.GetModerationActions(r.Context(), moderationLogLimit)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get moderation actions", err)
+		return
+	}
+
+	res := make([]ModerationAction, len(actions))
+	for i, action := range actions {
+		res[i] = newModerationAction(action)
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
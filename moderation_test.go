@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// makeAdmin gives user the admin role.
+func makeAdmin(t *testing.T, cfg *apiConfig, user testUser) {
+	t.Helper()
+
+	if _, err := cfg.dbConn.Exec("UPDATE users SET role = $2 WHERE id = $1", user.ID, roleAdmin); err != nil {
+		t.Fatalf("failed to make admin: %v", err)
+	}
+}
+
+func TestResolveReportOnce(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	author := createTestUser(t, cfg, "author")
+	reporters := []testUser{createTestUser(t, cfg, "reporter1"), createTestUser(t, cfg, "reporter2")}
+	moderators := []testUser{createTestUser(t, cfg, "moderator1"), createTestUser(t, cfg, "moderator2")}
+	for _, moderator := range moderators {
+		makeAdmin(t, cfg, moderator)
+	}
+
+	chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "spam", UserID: author.ID})
+	if err != nil {
+		t.Fatalf("failed to create chirp: %v", err)
+	}
+	reportIDs := make([]uuid.UUID, len(reporters))
+	for i, reporter := range reporters {
+		report, err := cfg.db.CreateReport(ctx, database.CreateReportParams{
+			ChirpID:    chirp.ID,
+			ReporterID: reporter.ID,
+			Reason:     "spam",
+		})
+		if err != nil {
+			t.Fatalf("failed to create report: %v", err)
+		}
+		reportIDs[i] = report.ID
+	}
+
+	// Each moderator takes a different report on the same chirp
+	actions := []map[string]any{
+		{"action": actionHideChirp},
+		{"action": actionSuspendUser, "suspend_days": 7},
+	}
+	requests := make([]*http.Request, len(moderators))
+	for i, moderator := range moderators {
+		requests[i] = newTestRequest(t, "POST", "/api/moderation/reports/"+reportIDs[i].String()+"/resolve", &moderator, actions[i],
+			"reportID", reportIDs[i].String())
+	}
+	codes := make([]int, len(requests))
+	var wg sync.WaitGroup
+	for i, r := range requests {
+		wg.Go(func() {
+			rec := httptest.NewRecorder()
+			cfg.handlerResolveReport(rec, r)
+			codes[i] = rec.Code
+		})
+	}
+	wg.Wait()
+
+	ok, conflicts := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+	if ok != 1 || conflicts != 1 {
+		t.Fatalf("expected one decision and one conflict, got statuses %v", codes)
+	}
+
+	logged, err := cfg.db.GetModerationActions(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to get moderation actions: %v", err)
+	}
+	if len(logged) != 1 {
+		t.Errorf("expected 1 moderation action, got %d", len(logged))
+	}
+
+	for _, id := range reportIDs {
+		report, err := cfg.db.GetReport(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to get report: %v", err)
+		}
+		if report.Status != reportActioned {
+			t.Errorf("expected report %s to be %s, got %s", id, reportActioned, report.Status)
+		}
+	}
+
+	r := newTestRequest(t, "POST", "/api/moderation/reports/"+reportIDs[0].String()+"/resolve", &moderators[0],
+		map[string]any{"action": actionDismiss}, "reportID", reportIDs[0].String())
+	serveTest(t, cfg.handlerResolveReport, r, http.StatusConflict, nil)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/metrics"
+	"github.com/Quak1/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const polkaSignatureTolerance = 5 * time.Minute
+
+func (cfg *apiConfig) handlerPolkaWebhooks(w http.ResponseWriter, r *http.Request) {
+	// The signature covers the raw body, so it is read before decoding.
+	// Unknown fields are allowed, Polka may add to its payloads.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.maxJSONBodyBytes))
+	if err != nil {
+		respondDecodeError(w, r, err)
+		return
+	}
+
+	err = webhook.Verify(r.Header.Get("Polka-Signature"), body, cfg.polkaSecrets, polkaSignatureTolerance, time.Now())
+	if err != nil {
+		respondError(w, r, http.StatusUnauthorized, codeInvalidSignature, "invalid webhook signature", err)
+		return
+	}
+
+	params := struct {
+		ID    string `json:"id" validate:"required"`
+		Event string `json:"event" validate:"required"`
+		Data  struct {
+			UserID      uuid.UUID  `json:"user_id"`
+			Plan        string     `json:"plan"`
+			PeriodStart *time.Time `json:"period_start"`
+			PeriodEnd   *time.Time `json:"period_end"`
+		} `json:"data"`
+	}{}
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		respondDecodeError(w, r, err)
+		return
+	}
+
+	if !validateParams(w, r, &params) {
+		return
+	}
+
+	metrics.WebhooksReceived.WithLabelValues("polka", params.Event).Inc()
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to process webhook", err)
+		return
+	}
+	defer tx.Rollback()
+
+	recorded, err := qtx.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+		Provider: "polka",
+		ID:       params.ID,
+		Event:    params.Event,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to process webhook", err)
+		return
+	}
+
+	// Already processed, acknowledge so Polka stops retrying
+	if recorded == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = applySubscriptionEvent(r.Context(), qtx, subscriptionEvent{
+		Event:       params.Event,
+		UserID:      params.Data.UserID,
+		Plan:        params.Data.Plan,
+		PeriodStart: params.Data.PeriodStart,
+		PeriodEnd:   params.Data.PeriodEnd,
+	}, time.Now())
+	if errors.Is(err, errUserNotFound) {
+		respondError(w, r, http.StatusNotFound, codeNotFound, "user not found", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to process webhook", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to process webhook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
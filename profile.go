@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlePattern is what a handle may look like. "me" and other route
+// names are too short or contain characters a handle can't, so handles
+// never clash with the /api/users/... routes.
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+const (
+	avatarDir      = "avatars"
+	maxAvatarBytes = 512 << 10
+)
+
+// avatarTypes maps the image types accepted as avatars to the extension
+// they are stored with.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Profile is the public view of a user. It is served without
+// authentication, so it must never include the email or anything else
+// private.
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url,omitempty"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	CreatedAt      time.Time `json:"created_at"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+	ChirpCount     int64     `json:"chirp_count"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+}
+
+// avatarURL returns where an avatar stored at avatarPath, relative to the
+// media directory, is served from.
+func avatarURL(avatarPath sql.NullString) string {
+	if !avatarPath.Valid {
+		return ""
+	}
+	return "/media/" + avatarPath.String
+}
+
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := cfg.db.GetUserProfile(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Profile{
+		ID:             profile.ID,
+		Handle:         profile.Handle,
+		DisplayName:    profile.DisplayName,
+		Bio:            profile.Bio,
+		AvatarURL:      avatarURL(profile.AvatarPath),
+		IsChirpyRed:    profile.IsChirpyRed,
+		CreatedAt:      profile.CreatedAt,
+		FollowerCount:  profile.FollowerCount,
+		FollowingCount: profile.FollowingCount,
+		ChirpCount:     profile.ChirpCount,
+	})
+}
+
+// lookupHandle returns the active user with the handle in the request
+// path. On failure it writes the error response and returns false.
+func (cfg *apiConfig) lookupHandle(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	user, err := cfg.db.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err == nil && (restriction(user, time.Now()) != nil || user.DeletedAt.Valid) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	followee, ok := cfg.lookupHandle(w, r)
+	if !ok {
+		return
+	}
+	if followee.ID == userID {
+		respondError(w, r, http.StatusBadRequest, codeCannotFollowSelf, "you can't follow yourself", nil)
+		return
+	}
+	if !cfg.checkNotBlocked(w, r, userID, followee.ID) {
+		return
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to follow user", err)
+		return
+	}
+	defer tx.Rollback()
+
+	follow := Follow{FollowerID: userID, FolloweeID: followee.ID}
+	followed, err := qtx.FollowUser(r.Context(), database.FollowUserParams(follow))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to follow user", err)
+		return
+	}
+
+	// Following twice is a no-op and doesn't notify anyone again
+	if followed > 0 {
+		if err := enqueueEvent(r.Context(), qtx, followee.ID, eventUserFollowed, follow); err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to follow user", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to follow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	// Unlike following, unfollowing works whatever the state of the other
+	// account
+	followee, err := cfg.db.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	_, err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUploadAvatar replaces the user's avatar with the image in the
+// request body. The image type is sniffed from its content, not taken
+// from the Content-Type header.
+func (cfg *apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAvatarBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "avatar must be at most 512KiB", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidBody, "failed to read avatar", err)
+		return
+	}
+
+	ext, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		respondError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "avatar must be a PNG, JPEG, GIF or WebP image", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	// Every upload gets a new name so cached copies of the old avatar are
+	// never served in its place
+	avatarPath := path.Join(avatarDir, rand.Text()+ext)
+	if err := cfg.writeMedia(avatarPath, data); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to save avatar", err)
+		return
+	}
+
+	updatedUser, err := cfg.db.SetUserAvatar(r.Context(), database.SetUserAvatarParams{
+		ID:         userID,
+		AvatarPath: nullString(&avatarPath),
+	})
+	if err != nil {
+		cfg.removeMedia(nullString(&avatarPath))
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to save avatar", err)
+		return
+	}
+	cfg.removeMedia(user.AvatarPath)
+
+	respondJSON(w, http.StatusOK, newUser(updatedUser))
+}
+
+func (cfg *apiConfig) handlerDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondLookupError(w, r, "user", err)
+		return
+	}
+
+	_, err = cfg.db.SetUserAvatar(r.Context(), database.SetUserAvatarParams{ID: userID})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete avatar", err)
+		return
+	}
+	cfg.removeMedia(user.AvatarPath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAvatar serves an uploaded avatar. Names are never reused, so
+// clients may cache them forever.
+func (cfg *apiConfig) handlerAvatar(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.PathValue("name"))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, filepath.Join(cfg.mediaDir, avatarDir, name))
+}
+
+func (cfg *apiConfig) writeMedia(name string, data []byte) error {
+	file := filepath.Join(cfg.mediaDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// removeMedia deletes a stored file that is no longer referenced. A file
+// left behind only wastes space, so failures are logged and ignored.
+func (cfg *apiConfig) removeMedia(name sql.NullString) {
+	if !name.Valid {
+		return
+	}
+
+	err := os.Remove(filepath.Join(cfg.mediaDir, filepath.FromSlash(name.String)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("failed to remove media file", "file", name.String, "error", err)
+	}
+}
+
+// nullString converts an optional parameter to a nullable column value.
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/auth"
+	"github.com/Quak1/chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+// redRateLimitFactor multiplies the limits of Chirpy Red members with the
+// higher_rate_limits feature.
+const redRateLimitFactor = 5
+
+// defaultRateLimits are the limits for each rate limited route. RATE_LIMITS
+// overrides them with entries like "login=20/1m", and a count of 0 turns a
+// limit off.
+var defaultRateLimits = map[string]string{
+	"login":          "10/1m",
+	"create_user":    "5/1m",
+	"refresh":        "30/1m",
+	"create_chirp":   "30/1m",
+	"create_webhook": "10/1m",
+	"export_data":    "5/1h",
+	"create_report":  "10/1h",
+}
+
+func parseRateLimits(overrides []string) (map[string]ratelimit.Limit, error) {
+	values := map[string]string{}
+	for route, value := range defaultRateLimits {
+		values[route] = value
+	}
+
+	for _, override := range overrides {
+		route, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, want route=count/period", override)
+		}
+		if _, ok := defaultRateLimits[route]; !ok {
+			return nil, fmt.Errorf("unknown rate limited route %q", route)
+		}
+		values[route] = value
+	}
+
+	limits := map[string]ratelimit.Limit{}
+	for route, value := range values {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", route, err)
+		}
+		limits[route] = limit
+	}
+
+	return limits, nil
+}
+
+// rateLimit limits requests to next with the limit configured for route.
+// Authenticated requests are counted per user and the rest per client IP.
+// The limiter fails open, an unavailable store doesn't take the API down.
+func (cfg *apiConfig) rateLimit(route string, next http.HandlerFunc) http.Handler {
+	limit, ok := cfg.rateLimits[route]
+	if !ok {
+		panic("no rate limit configured for " + route)
+	}
+	if limit.Disabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, limit := cfg.rateLimitKey(r, limit)
+
+		res, err := cfg.rateLimiter.Take(r.Context(), route+":"+key, limit)
+		if err != nil {
+			loggerFrom(r.Context()).Error("rate limiter failed", "route", route, "error", err)
+			next(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Burst, ceilSeconds(limit.Period)))
+
+		if !res.Allowed {
+			header.Set("Retry-After", ceilSeconds(res.RetryAfter))
+			respondError(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded", nil)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// rateLimitKey returns the bucket key for the request and the limit that
+// applies to it.
+func (cfg *apiConfig) rateLimitKey(r *http.Request, limit ratelimit.Limit) (string, ratelimit.Limit) {
+	userID, ok := cfg.bearerUser(r)
+	if !ok {
+		return "ip:" + clientIP(r, cfg.trustProxy), limit
+	}
+
+	if cfg.redFeatures[featureHigherRateLimits] {
+		user, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err == nil && cfg.hasFeature(user, featureHigherRateLimits) {
+			limit = limit.Scale(redRateLimitFactor)
+		}
+	}
+
+	return "user:" + userID.String(), limit
+}
+
+// bearerUser returns the user of a valid access token. Unlike authenticate
+// it doesn't fail the request, the handler decides what to do without one.
+func (cfg *apiConfig) bearerUser(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// clientIP returns the address of the client. Behind a proxy, TRUST_PROXY
+// uses the last X-Forwarded-For entry, the one added by our own proxy,
+// since earlier entries can be set by the client.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// runRateLimitPrune deletes buckets from the shared store once they have
+// been idle long enough to be full again.
+func (cfg *apiConfig) runRateLimitPrune(ctx context.Context, store *ratelimit.PostgresStore, interval time.Duration) {
+	var idle time.Duration
+	for _, limit := range cfg.rateLimits {
+		idle = max(idle, limit.Period)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := store.Prune(ctx, idle)
+		if err != nil {
+			slog.Error("failed to prune rate limit buckets", "error", err)
+		} else if pruned > 0 {
+			slog.Info("pruned rate limit buckets", "count", pruned)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+const scheduledChirpBatchSize = 100
+
+type ScheduledChirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	PublishAt time.Time `json:"publish_at"`
+}
+
+func newScheduledChirp(scheduled database.ScheduledChirp) ScheduledChirp {
+	return ScheduledChirp{
+		ID:        scheduled.ID,
+		CreatedAt: scheduled.CreatedAt,
+		UpdatedAt: scheduled.UpdatedAt,
+		Body:      scheduled.Body,
+		UserID:    scheduled.UserID,
+		PublishAt: scheduled.PublishAt,
+	}
+}
+
+// checkPublishAt fails the request unless publishAt is in the future. On
+// failure it writes the error response and returns false.
+func checkPublishAt(w http.ResponseWriter, r *http.Request, publishAt time.Time) bool {
+	if !publishAt.After(time.Now()) {
+		respondValidationError(w, r, fieldError{Field: "publish_at", Code: "future", Message: "must be in the future"})
+		return false
+	}
+	return true
+}
+
+// scheduleChirp stores body, already validated, to be published by user
+// at publishAt.
+func (cfg *apiConfig) scheduleChirp(w http.ResponseWriter, r *http.Request, user database.User, body string, publishAt time.Time) {
+	if !cfg.hasFeature(user, featureScheduledChirps) {
+		respondError(w, r, http.StatusForbidden, codeFeatureUnavailable, "scheduling chirps requires Chirpy Red", nil)
+		return
+	}
+	if !checkPublishAt(w, r, publishAt) {
+		return
+	}
+
+	scheduled, err := cfg.db.CreateScheduledChirp(r.Context(), database.CreateScheduledChirpParams{
+		UserID:    user.ID,
+		Body:      body,
+		PublishAt: publishAt.UTC(),
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to schedule chirp", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, newScheduledChirp(scheduled))
+}
+
+// handlerGetScheduledChirps lists the authenticated user's chirps waiting
+// to be published, the next one first.
+func (cfg *apiConfig) handlerGetScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	scheduled, err := cfg.db.GetUserScheduledChirps(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get scheduled chirps", err)
+		return
+	}
+
+	res := make([]ScheduledChirp, len(scheduled))
+	for i, s := range scheduled {
+		res[i] = newScheduledChirp(s)
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+// handlerUpdateScheduledChirp changes the body or publish time of a chirp
+// that hasn't been published yet. Other users' scheduled chirps are
+// private, so they are reported as not found.
+func (cfg *apiConfig) handlerUpdateScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      *string    `json:"body" validate:"omitnil,min=1"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid scheduled chirp id", err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
+		return
+	}
+
+	if !cfg.hasFeature(user, featureScheduledChirps) {
+		respondError(w, r, http.StatusForbidden, codeFeatureUnavailable, "scheduling chirps requires Chirpy Red", nil)
+		return
+	}
+
+	update := database.UpdateScheduledChirpParams{
+		ID:     scheduledID,
+		UserID: userID,
+	}
+	if params.Body != nil {
+		cleaned, err := validateChirp(*params.Body, cfg.maxChirpLength(user))
+		if err != nil {
+			respondValidationError(w, r, fieldError{Field: "body", Code: "too_long", Message: err.Error()})
+			return
+		}
+		update.Body = nullString(&cleaned)
+	}
+	if params.PublishAt != nil {
+		if !checkPublishAt(w, r, *params.PublishAt) {
+			return
+		}
+		update.PublishAt = sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}
+	}
+
+	// A chirp being published holds its row lock, so this waits for it
+	// and then finds the row gone
+	scheduled, err := cfg.db.UpdateScheduledChirp(r.Context(), update)
+	if err != nil {
+		respondLookupError(w, r, "scheduled chirp", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newScheduledChirp(scheduled))
+}
+
+// handlerCancelScheduledChirp drops a chirp that hasn't been published
+// yet. Cancelling doesn't need Chirpy Red, members who left can still
+// clean up.
+func (cfg *apiConfig) handlerCancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid scheduled chirp id", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     scheduledID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to cancel scheduled chirp", err)
+		return
+	}
+	if deleted == 0 {
+		respondLookupError(w, r, "scheduled chirp", sql.ErrNoRows)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runChirpScheduler publishes scheduled chirps once they are due. Every
+// instance runs it, the rows being published are locked so each chirp is
+// published exactly once.
+func (cfg *apiConfig) runChirpScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			published, err := cfg.publishDueChirps(ctx)
+			if err != nil {
+				slog.Error("failed to publish scheduled chirps", "error", err)
+				break
+			}
+			if published < scheduledChirpBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueChirps publishes a batch of due chirps in one transaction and
+// returns how many it published. Chirps of authors who can't post right
+// now are left until they can.
+func (cfg *apiConfig) publishDueChirps(ctx context.Context) (int, error) {
+	tx, qtx, err := cfg.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	due, err := qtx.ClaimDueScheduledChirps(ctx, scheduledChirpBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, scheduled := range due {
+		chirp, err := qtx.CreateChirp(ctx, database.CreateChirpParams{
+			Body:   scheduled.Body,
+			UserID: scheduled.UserID,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err := enqueueEvent(ctx, qtx, chirp.UserID, eventChirpCreated, newChirp(chirp)); err != nil {
+			return 0, err
+		}
+		if err := qtx.RemoveScheduledChirp(ctx, scheduled.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.ChirpsCreated.Add(float64(len(due)))
+
+	return len(due), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// makeChirpyRed gives user a Chirpy Red membership.
+func makeChirpyRed(t *testing.T, cfg *apiConfig, user testUser) {
+	t.Helper()
+
+	if _, err := cfg.dbConn.Exec("UPDATE users SET is_chirpy_red = true WHERE id = $1", user.ID); err != nil {
+		t.Fatalf("failed to upgrade user: %v", err)
+	}
+}
+
+func TestScheduleChirpTimeZones(t *testing.T) {
+	cfg := newTestConfig(t)
+	user := createTestUser(t, cfg, "scheduler")
+	makeChirpyRed(t, cfg, user)
+
+	tests := []struct {
+		name   string
+		offset int
+	}{
+		{name: "UTC", offset: 0},
+		{name: "behind UTC", offset: -7 * 60 * 60},
+		{name: "ahead of UTC", offset: 5*60*60 + 30*60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := time.FixedZone(tt.name, tt.offset)
+			publishAt := time.Now().Add(time.Hour).In(zone).Truncate(time.Second)
+
+			var scheduled ScheduledChirp
+			r := newTestRequest(t, "POST", "/api/chirps", &user, map[string]any{
+				"body":       "later",
+				"publish_at": publishAt,
+			})
+			serveTest(t, cfg.handlerCreateChirp, r, http.StatusCreated, &scheduled)
+			if !scheduled.PublishAt.Equal(publishAt) {
+				t.Errorf("expected publish_at %v, got %v", publishAt, scheduled.PublishAt)
+			}
+
+			published, err := cfg.publishDueChirps(context.Background())
+			if err != nil {
+				t.Fatalf("failed to publish due chirps: %v", err)
+			}
+			if published != 0 {
+				t.Errorf("expected nothing to be published, got %d chirps", published)
+			}
+
+			publishAt = publishAt.Add(time.Hour)
+			r = newTestRequest(t, "PUT", "/api/chirps/scheduled/"+scheduled.ID.String(), &user, map[string]any{
+				"publish_at": publishAt,
+			}, "scheduledID", scheduled.ID.String())
+			serveTest(t, cfg.handlerUpdateScheduledChirp, r, http.StatusOK, &scheduled)
+			if !scheduled.PublishAt.Equal(publishAt) {
+				t.Errorf("expected publish_at %v after update, got %v", publishAt, scheduled.PublishAt)
+			}
+		})
+	}
+}
+
+func TestPublishDueChirps(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	author := createTestUser(t, cfg, "author")
+	suspended := createTestUser(t, cfg, "suspended")
+	for _, user := range []testUser{author, suspended} {
+		makeChirpyRed(t, cfg, user)
+	}
+
+	schedule := func(user testUser, body string) ScheduledChirp {
+		t.Helper()
+		var scheduled ScheduledChirp
+		r := newTestRequest(t, "POST", "/api/chirps", &user, map[string]any{
+			"body":       body,
+			"publish_at": time.Now().Add(time.Hour),
+		})
+		serveTest(t, cfg.handlerCreateChirp, r, http.StatusCreated, &scheduled)
+		return scheduled
+	}
+	due := schedule(author, "due")
+	schedule(author, "later")
+	held := schedule(suspended, "held")
+
+	for _, scheduled := range []ScheduledChirp{due, held} {
+		_, err := cfg.dbConn.Exec("UPDATE scheduled_chirps SET publish_at = now() - interval '1 minute' WHERE id = $1", scheduled.ID)
+		if err != nil {
+			t.Fatalf("failed to make chirp due: %v", err)
+		}
+	}
+	_, _, err := setAccountStatus(ctx, cfg.db, suspended.ID, userStatusSuspended, time.Now().Add(time.Hour), "spam")
+	if err != nil {
+		t.Fatalf("failed to suspend user: %v", err)
+	}
+
+	// Every instance runs the scheduler, each due chirp is published once
+	const schedulers = 3
+	published := make([]int, schedulers)
+	errs := make([]error, schedulers)
+	var wg sync.WaitGroup
+	for i := range schedulers {
+		wg.Go(func() {
+			published[i], errs[i] = cfg.publishDueChirps(ctx)
+		})
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range schedulers {
+		if errs[i] != nil {
+			t.Fatalf("failed to publish due chirps: %v", errs[i])
+		}
+		total += published[i]
+	}
+	if total != 1 {
+		t.Errorf("expected 1 chirp to be published, got %d", total)
+	}
+
+	chirps, err := cfg.db.GetUserChirps(ctx, author.ID)
+	if err != nil {
+		t.Fatalf("failed to get chirps: %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "due" {
+		t.Errorf("expected the due chirp to be published, got %+v", chirps)
+	}
+
+	remaining, err := cfg.db.GetUserScheduledChirps(ctx, suspended.ID)
+	if err != nil {
+		t.Fatalf("failed to get scheduled chirps: %v", err)
+	}
+	if len(remaining) != 1 {
+		t.Errorf("expected the suspended user's chirp to wait, got %d scheduled", len(remaining))
+	}
+}
@@ -0,0 +1,43 @@
+-- name: BlockUser :execrows
+INSERT INTO blocks (blocker_id, blocked_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlockedUsers :many
+SELECT users.* FROM users
+JOIN blocks ON blocks.blocked_id = users.id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocker_id = @user_id AND blocked_id = @other_id)
+    OR (blocker_id = @other_id AND blocked_id = @user_id)
+) AS blocked;
+
+-- name: GetHiddenAuthorIDs :many
+SELECT blocked_id AS author_id FROM blocks WHERE blocker_id = @viewer_id
+UNION
+SELECT blocker_id FROM blocks WHERE blocked_id = @viewer_id
+UNION
+SELECT muted_id FROM mutes WHERE muter_id = @viewer_id;
+
+-- name: MuteUser :execrows
+INSERT INTO mutes (muter_id, muted_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :execrows
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutedUsers :many
+SELECT users.* FROM users
+JOIN mutes ON mutes.muted_id = users.id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC;
@@ -0,0 +1,22 @@
+-- name: GetChirpEvent :one
+SELECT * FROM chirp_events
+WHERE id = $1 AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirp_events.user_id AND users.deleted_at IS NOT NULL
+);
+
+-- name: GetChirpEventsAfter :many
+SELECT * FROM chirp_events
+WHERE id > $1 AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirp_events.user_id AND users.deleted_at IS NOT NULL
+)
+ORDER BY id ASC
+LIMIT 1000;
+
+-- name: DeleteChirpEventsBefore :execrows
+DELETE FROM chirp_events
+WHERE created_at < $1;
+
+-- name: GetLatestChirpEventID :one
+SELECT COALESCE(MAX(id), 0)::bigint AS id FROM chirp_events;
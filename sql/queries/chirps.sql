@@ -5,17 +5,86 @@ RETURNING *;
 
 -- name: GetAllChirps :many
 SELECT * FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetUserChirps :many
 SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: GetUserChirpsIncludingDeleted :many
+SELECT * FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetChirpIncludingDeleted :one
+SELECT * FROM chirps
 WHERE id = $1;
 
--- name: DeleteChirp :exec
+-- name: LookupChirp :one
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.deleted_at IS NULL;
+
+-- name: DeleteChirp :one
+UPDATE chirps
+SET deleted_at = now()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
 DELETE FROM chirps
-WHERE id = $1; 
+WHERE deleted_at < $1;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = now()
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+RETURNING *;
+
+-- name: GetVisibleChirps :many
+SELECT * FROM chirps
+WHERE hidden_at IS NULL AND deleted_at IS NULL AND NOT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocks.blocker_id = @viewer_id AND blocks.blocked_id = chirps.user_id)
+    OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = @viewer_id)
+) AND NOT EXISTS (
+  SELECT 1 FROM mutes
+  WHERE mutes.muter_id = @viewer_id AND mutes.muted_id = chirps.user_id
+) AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+)
+ORDER BY created_at ASC;
+
+-- name: GetVisibleUserChirps :many
+SELECT * FROM chirps
+WHERE user_id = @user_id AND hidden_at IS NULL AND deleted_at IS NULL AND NOT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocks.blocker_id = @viewer_id AND blocks.blocked_id = chirps.user_id)
+    OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = @viewer_id)
+) AND NOT EXISTS (
+  SELECT 1 FROM mutes
+  WHERE mutes.muter_id = @viewer_id AND mutes.muted_id = chirps.user_id
+) AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+)
+ORDER BY created_at ASC;
+
+-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = COALESCE(hidden_at, now())
+WHERE id = $1
+RETURNING *;
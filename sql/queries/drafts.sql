@@ -0,0 +1,28 @@
+-- name: CreateDraft :one
+INSERT INTO drafts (user_id, body)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetUserDrafts :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $3, updated_at = now()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: TakeDraft :one
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2
+RETURNING *;
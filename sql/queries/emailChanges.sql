@@ -0,0 +1,12 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (token_hash, user_id, new_email, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetEmailChange :one
+SELECT * FROM email_changes
+WHERE token_hash = $1;
+
+-- name: DeleteUserEmailChanges :exec
+DELETE FROM email_changes
+WHERE user_id = $1;
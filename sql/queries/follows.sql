@@ -0,0 +1,25 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (follower_id, followee_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: DeleteFollowsBetween :execrows
+DELETE FROM follows
+WHERE (follower_id = @user_id AND followee_id = @other_id)
+  OR (follower_id = @other_id AND followee_id = @user_id);
+
+-- name: GetFollowing :many
+SELECT users.id, users.handle, follows.created_at FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = $1
+ORDER BY follows.created_at ASC;
+
+-- name: GetFollowers :many
+SELECT users.id, users.handle, follows.created_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1
+ORDER BY follows.created_at ASC;
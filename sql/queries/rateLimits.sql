@@ -0,0 +1,16 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (@key, @burst::float8 - 1, true, now())
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+    WHEN LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8) >= 1
+    THEN LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8) - 1
+    ELSE LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8)
+  END,
+  allowed = LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteRateLimitBucketsBefore :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
@@ -11,3 +11,13 @@ WHERE token = $1;
 UPDATE refresh_tokens
 SET revoked_at = now()
 WHERE token = $1;
+
+-- name: RevokeUserRefreshTokens :execrows
+UPDATE refresh_tokens
+SET revoked_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: GetUserRefreshTokens :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at ASC;
@@ -0,0 +1,37 @@
+-- name: CreateReport :one
+INSERT INTO reports (chirp_id, reporter_id, reason, details)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetUserReports :many
+SELECT * FROM reports
+WHERE reporter_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: GetOpenReports :many
+SELECT reports.*, chirps.body AS chirp_body, chirps.user_id AS author_id,
+  (SELECT count(*) FROM reports AS others WHERE others.chirp_id = reports.chirp_id AND others.status = 'open') AS open_reports
+FROM reports
+JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = 'open'
+ORDER BY reports.created_at ASC;
+
+-- name: ResolveChirpReports :many
+UPDATE reports
+SET status = $2, resolved_at = now(), resolved_by = $3
+WHERE chirp_id = $1 AND status = 'open'
+RETURNING id;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (moderator_id, action, report_id, chirp_id, target_user_id, reason)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT $1;
@@ -0,0 +1,35 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (user_id, body, publish_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetUserScheduledChirps :many
+SELECT * FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at ASC;
+
+-- name: UpdateScheduledChirp :one
+UPDATE scheduled_chirps
+SET body = COALESCE(sqlc.narg(body), body),
+    publish_at = COALESCE(sqlc.narg(publish_at), publish_at),
+    updated_at = now()
+WHERE id = @id AND user_id = @user_id
+RETURNING *;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: ClaimDueScheduledChirps :many
+SELECT scheduled_chirps.* FROM scheduled_chirps
+JOIN users ON users.id = scheduled_chirps.user_id
+WHERE scheduled_chirps.publish_at <= now()
+  AND users.deleted_at IS NULL
+  AND (users.status = 'active' OR (users.status = 'suspended' AND users.suspended_until <= now()))
+ORDER BY scheduled_chirps.publish_at ASC
+LIMIT $1
+FOR UPDATE OF scheduled_chirps SKIP LOCKED;
+
+-- name: RemoveScheduledChirp :exec
+DELETE FROM scheduled_chirps
+WHERE id = $1;
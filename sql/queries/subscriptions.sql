@@ -0,0 +1,25 @@
+-- name: GetSubscriptionByUser :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (user_id, plan, status, current_period_start, current_period_end)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    updated_at = now()
+RETURNING *;
+
+-- name: CreateSubscriptionHistory :exec
+INSERT INTO subscription_history (subscription_id, event, plan, status, period_start, period_end)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetUserSubscriptionHistory :many
+SELECT * FROM subscription_history
+WHERE subscription_id IN (
+  SELECT id FROM subscriptions WHERE user_id = $1
+)
+ORDER BY created_at ASC;
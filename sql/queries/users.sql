@@ -13,14 +13,109 @@ SELECT * FROM users
 WHERE users.email = $1;
 
 
--- name: UpdateUser :one
+-- name: SyncChirpyRed :exec
 UPDATE users
-SET hashed_password = $2, email = $3, updated_at = $4
-WHERE users.id = $1
-RETURNING *;
+SET is_chirpy_red = EXISTS (
+  SELECT 1 FROM subscriptions
+  WHERE subscriptions.user_id = users.id
+    AND subscriptions.status = 'active'
+    AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > now())
+), updated_at = now()
+WHERE id = $1;
 
 
--- name: UpgradeChirpyRed :exec
+-- name: ExpireChirpyRed :execrows
 UPDATE users
-SET is_chirpy_red = true
+SET is_chirpy_red = false, updated_at = now()
+WHERE is_chirpy_red AND NOT EXISTS (
+  SELECT 1 FROM subscriptions
+  WHERE subscriptions.user_id = users.id
+    AND subscriptions.status = 'active'
+    AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > now())
+);
+
+
+-- name: GetUserByID :one
+SELECT * FROM users
 WHERE id = $1;
+
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: SetUserStatus :one
+UPDATE users
+SET status = $2, suspended_until = $3, status_reason = $4, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: SetUserPassword :one
+UPDATE users
+SET hashed_password = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: SetUserEmail :one
+UPDATE users
+SET email = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower(@handle);
+
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = COALESCE(sqlc.narg(handle), handle),
+  display_name = COALESCE(sqlc.narg(display_name), display_name),
+  bio = COALESCE(sqlc.narg(bio), bio),
+  updated_at = now()
+WHERE id = @id
+RETURNING *;
+
+
+-- name: SetUserAvatar :one
+UPDATE users
+SET avatar_path = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: GetUserProfile :one
+SELECT users.id, users.handle, users.display_name, users.bio, users.avatar_path, users.is_chirpy_red, users.created_at,
+  (SELECT count(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+  (SELECT count(*) FROM follows WHERE follows.follower_id = users.id) AS following_count,
+  (SELECT count(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL) AS chirp_count
+FROM users
+WHERE lower(users.handle) = lower(@handle)
+  AND (users.status = 'active' OR (users.status = 'suspended' AND users.suspended_until <= now()))
+  AND users.deleted_at IS NULL;
+
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deleted_at = COALESCE(deleted_at, now()), updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: CancelUserDeletion :one
+UPDATE users
+SET deleted_at = NULL, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: PurgeDeletedUsers :many
+DELETE FROM users
+WHERE deleted_at < $1
+RETURNING *;
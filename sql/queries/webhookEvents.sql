@@ -0,0 +1,4 @@
+-- name: RecordWebhookEvent :execrows
+INSERT INTO webhook_events (provider, id, event)
+VALUES ($1, $2, $3)
+ON CONFLICT (provider, id) DO NOTHING;
@@ -0,0 +1,71 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (user_id, url, secret, events)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: GetUserWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (endpoint_id, event, payload)
+SELECT id, @event::text, @payload::text::jsonb
+FROM webhook_endpoints
+WHERE user_id = @user_id AND active AND @event::text = ANY(events);
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = now() + make_interval(secs => @lease_seconds), updated_at = now()
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at ASC
+  LIMIT @batch_size
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateWebhookDeliveryAttempt :exec
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = attempts + 1,
+    last_attempt_at = now(),
+    next_attempt_at = $3,
+    response_status = $4,
+    last_error = $5,
+    updated_at = now()
+WHERE id = $1;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error, duration_ms)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+-- name: GetEndpointWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT 100;
+
+-- name: GetWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempted_at ASC;
+
+-- name: ResetWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING *;
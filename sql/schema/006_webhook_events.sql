@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+  provider TEXT NOT NULL,
+  id TEXT NOT NULL,
+  event TEXT NOT NULL,
+  received_at TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY (provider, id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP NOT NULL DEFAULT now(),
+  user_id UUID UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  plan TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('active', 'canceled', 'refunded')),
+  current_period_start TIMESTAMP NOT NULL,
+  current_period_end TIMESTAMP
+);
+
+CREATE TABLE subscription_history (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  event TEXT NOT NULL,
+  plan TEXT NOT NULL,
+  status TEXT NOT NULL,
+  period_start TIMESTAMP NOT NULL,
+  period_end TIMESTAMP
+);
+
+INSERT INTO subscriptions (user_id, plan, status, current_period_start)
+SELECT id, 'red', 'active', updated_at
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscription_history;
+DROP TABLE subscriptions;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+ADD status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled'));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN status,
+DROP COLUMN role;
@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE users
+ADD handle TEXT NOT NULL DEFAULT 'user_' || substr(md5(random()::text), 1, 10),
+ADD display_name TEXT NOT NULL DEFAULT '',
+ADD bio TEXT NOT NULL DEFAULT '',
+ADD avatar_path TEXT;
+
+-- Handles are unique regardless of case, @Alice and @alice are the same user
+CREATE UNIQUE INDEX users_handle_idx ON users (lower(handle));
+
+CREATE TABLE follows (
+  follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY (follower_id, followee_id),
+  CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id);
+
+-- +goose Down
+DROP TABLE follows;
+
+DROP INDEX users_handle_idx;
+
+ALTER TABLE users
+DROP COLUMN avatar_path,
+DROP COLUMN bio,
+DROP COLUMN display_name,
+DROP COLUMN handle;
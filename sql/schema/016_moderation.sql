@@ -0,0 +1,51 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD hidden_at TIMESTAMP;
+
+-- Hiding a chirp takes it out of public view, so stream subscribers see
+-- it as deleted
+CREATE TRIGGER chirps_record_hidden
+AFTER UPDATE OF hidden_at ON chirps
+FOR EACH ROW
+WHEN (OLD.hidden_at IS NULL AND NEW.hidden_at IS NOT NULL)
+EXECUTE FUNCTION record_chirp_event();
+
+CREATE TABLE reports (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'misinformation', 'other')),
+  details TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+  resolved_at TIMESTAMP,
+  resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  UNIQUE (chirp_id, reporter_id)
+);
+
+CREATE INDEX reports_open_idx ON reports (created_at) WHERE status = 'open';
+
+-- The audit trail outlives the chirps and users it mentions, so only the
+-- moderator is a foreign key
+CREATE TABLE moderation_actions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,
+  report_id UUID,
+  chirp_id UUID,
+  target_user_id UUID,
+  reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX moderation_actions_created_at_idx ON moderation_actions (created_at);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+
+DROP TABLE reports;
+
+DROP TRIGGER chirps_record_hidden ON chirps;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
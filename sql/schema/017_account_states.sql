@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+DROP CONSTRAINT users_status_check;
+
+UPDATE users SET status = 'banned' WHERE status = 'disabled';
+
+ALTER TABLE users
+ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'banned')),
+ADD suspended_until TIMESTAMP,
+ADD status_reason TEXT NOT NULL DEFAULT '',
+ADD CONSTRAINT users_suspended_until_check CHECK ((status = 'suspended') = (suspended_until IS NOT NULL));
+
+-- +goose Down
+ALTER TABLE users
+DROP CONSTRAINT users_suspended_until_check,
+DROP CONSTRAINT users_status_check,
+DROP COLUMN status_reason,
+DROP COLUMN suspended_until;
+
+UPDATE users SET status = 'disabled' WHERE status <> 'active';
+
+ALTER TABLE users
+ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'disabled'));
@@ -0,0 +1,85 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- A chirp leaves public view when it is hidden or soft deleted and comes
+-- back when restored, so stream subscribers see those as deletions and
+-- creations. Purging a chirp that already left doesn't notify again.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_chirp_event() RETURNS trigger AS $$
+DECLARE
+  event_id BIGINT;
+BEGIN
+  IF TG_OP = 'DELETE' AND (OLD.deleted_at IS NOT NULL OR OLD.hidden_at IS NOT NULL) THEN
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.deleted_at IS NULL AND NEW.hidden_at IS NULL) THEN
+    INSERT INTO chirp_events (event, chirp_id, user_id, body, chirp_created_at, chirp_updated_at)
+    VALUES ('chirp.created', NEW.id, NEW.user_id, NEW.body, NEW.created_at, NEW.updated_at)
+    RETURNING id INTO event_id;
+  ELSE
+    INSERT INTO chirp_events (event, chirp_id, user_id, body, chirp_created_at, chirp_updated_at)
+    VALUES ('chirp.deleted', OLD.id, OLD.user_id, OLD.body, OLD.created_at, OLD.updated_at)
+    RETURNING id INTO event_id;
+  END IF;
+
+  PERFORM pg_notify('chirp_events', event_id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_record_deleted
+AFTER UPDATE OF deleted_at ON chirps
+FOR EACH ROW
+WHEN (OLD.deleted_at IS DISTINCT FROM NEW.deleted_at AND NEW.hidden_at IS NULL)
+EXECUTE FUNCTION record_chirp_event();
+
+-- Hiding a deleted chirp changes nothing for subscribers
+DROP TRIGGER chirps_record_hidden ON chirps;
+
+CREATE TRIGGER chirps_record_hidden
+AFTER UPDATE OF hidden_at ON chirps
+FOR EACH ROW
+WHEN (OLD.hidden_at IS NULL AND NEW.hidden_at IS NOT NULL AND NEW.deleted_at IS NULL)
+EXECUTE FUNCTION record_chirp_event();
+
+-- +goose Down
+DROP TRIGGER chirps_record_hidden ON chirps;
+
+CREATE TRIGGER chirps_record_hidden
+AFTER UPDATE OF hidden_at ON chirps
+FOR EACH ROW
+WHEN (OLD.hidden_at IS NULL AND NEW.hidden_at IS NOT NULL)
+EXECUTE FUNCTION record_chirp_event();
+
+DROP TRIGGER chirps_record_deleted ON chirps;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_chirp_event() RETURNS trigger AS $$
+DECLARE
+  event_id BIGINT;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO chirp_events (event, chirp_id, user_id, body, chirp_created_at, chirp_updated_at)
+    VALUES ('chirp.created', NEW.id, NEW.user_id, NEW.body, NEW.created_at, NEW.updated_at)
+    RETURNING id INTO event_id;
+  ELSE
+    INSERT INTO chirp_events (event, chirp_id, user_id, body, chirp_created_at, chirp_updated_at)
+    VALUES ('chirp.deleted', OLD.id, OLD.user_id, OLD.body, OLD.created_at, OLD.updated_at)
+    RETURNING id INTO event_id;
+  END IF;
+
+  PERFORM pg_notify('chirp_events', event_id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP INDEX chirps_deleted_at_idx;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Chirps waiting to be published. They only become chirps when they are
+-- due, so nothing that reads chirps has to know about them.
+CREATE TABLE scheduled_chirps (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP NOT NULL DEFAULT now(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  publish_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps (user_id, publish_at);
+
+CREATE INDEX scheduled_chirps_publish_at_idx ON scheduled_chirps (publish_at);
+
+-- +goose Down
+DROP TABLE scheduled_chirps;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE drafts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP NOT NULL DEFAULT now(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX drafts_user_id_idx ON drafts (user_id, updated_at);
+
+-- +goose Down
+DROP TABLE drafts;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- publish_at is compared with now(), a plain TIMESTAMP dropped the offset
+-- clients scheduled with and published at the wrong time. Existing rows
+-- are read as UTC, which is what most clients send.
+ALTER TABLE scheduled_chirps
+  ALTER COLUMN publish_at TYPE TIMESTAMPTZ USING publish_at AT TIME ZONE 'UTC';
+
+-- +goose Down
+ALTER TABLE scheduled_chirps
+  ALTER COLUMN publish_at TYPE TIMESTAMP USING publish_at AT TIME ZONE 'UTC';
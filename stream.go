@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/stream"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	chirpEventsChannel   = "chirp_events"
+	chirpEventsRetention = 24 * time.Hour
+	streamHeartbeat      = 15 * time.Second
+	// chirpEventsPageSize is the LIMIT of GetChirpEventsAfter
+	chirpEventsPageSize = 1000
+	// streamMaxReplayPages bounds the replay for a reconnecting client.
+	// Clients further behind are told to reload instead.
+	streamMaxReplayPages = 10
+	// streamDedupWindow is how many sent event IDs a stream remembers. An
+	// event is only sent twice when it is both replayed and published
+	// live, which happens to events committed while the replay is read,
+	// far fewer than this.
+	streamDedupWindow = 4096
+
+	// streamEventReset tells a client that it missed events that won't be
+	// replayed. It should reload chirps from the API, the stream carries
+	// on from the current event.
+	streamEventReset = "stream.reset"
+)
+
+func newStreamEvent(e database.ChirpEvent) (stream.Event, error) {
+	data, err := json.Marshal(Chirp{
+		ID:        e.ChirpID,
+		CreatedAt: e.ChirpCreatedAt,
+		UpdatedAt: e.ChirpUpdatedAt,
+		Body:      e.Body,
+		UserID:    e.UserID,
+	})
+	if err != nil {
+		return stream.Event{}, err
+	}
+
+	return stream.Event{
+		ID:       e.ID,
+		Type:     e.Event,
+		AuthorID: e.UserID,
+		Data:     data,
+	}, nil
+}
+
+// runChirpEventListener LISTENs for chirp events written by the chirps
+// trigger and publishes them to this instance's stream subscribers. Every
+// instance runs its own listener, so a chirp created through any instance
+// reaches clients connected to all of them.
+func (cfg *apiConfig) runChirpEventListener(ctx context.Context, dbURL string) {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("chirp event listener", "error", err)
+		}
+	})
+	defer listener.Close()
+	// Listen blocks until the database is reachable, closing the listener
+	// is the only way to interrupt it
+	context.AfterFunc(ctx, func() { listener.Close() })
+
+	if err := listener.Listen(chirpEventsChannel); err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to listen for chirp events", "error", err)
+		}
+		return
+	}
+
+	lastID, err := cfg.db.GetLatestChirpEventID(ctx)
+	if err != nil {
+		slog.Error("failed to get latest chirp event", "error", err)
+	}
+
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established
+			// and notifications may have been missed while it was down
+			if n == nil {
+				lastID = cfg.publishChirpEventsAfter(ctx, lastID)
+				continue
+			}
+
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				slog.Error("bad chirp event notification", "payload", n.Extra, "error", err)
+				continue
+			}
+
+			// Events of users whose account is being deleted aren't found
+			event, err := cfg.db.GetChirpEvent(ctx, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				lastID = max(lastID, id)
+				continue
+			}
+			if err != nil {
+				slog.Error("failed to get chirp event", "event_id", id, "error", err)
+				continue
+			}
+
+			streamEvent, err := newStreamEvent(event)
+			if err != nil {
+				slog.Error("failed to encode chirp event", "event_id", id, "error", err)
+				continue
+			}
+			cfg.stream.Publish(streamEvent)
+			lastID = max(lastID, id)
+
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+
+		case <-prune.C:
+			_, err := cfg.db.DeleteChirpEventsBefore(ctx, time.Now().Add(-chirpEventsRetention))
+			if err != nil {
+				slog.Error("failed to prune chirp events", "error", err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) publishChirpEventsAfter(ctx context.Context, lastID int64) int64 {
+	for {
+		events, err := cfg.db.GetChirpEventsAfter(ctx, lastID)
+		if err != nil {
+			slog.Error("failed to get chirp events", "error", err)
+			return lastID
+		}
+
+		for _, event := range events {
+			streamEvent, err := newStreamEvent(event)
+			if err != nil {
+				slog.Error("failed to encode chirp event", "event_id", event.ID, "error", err)
+				continue
+			}
+			cfg.stream.Publish(streamEvent)
+			lastID = event.ID
+		}
+
+		if len(events) == 0 || ctx.Err() != nil {
+			return lastID
+		}
+	}
+}
+
+// newStreamReset returns the event sent instead of a replay that would be
+// too long. Its ID is the latest event's, so the client resumes from there
+// when it reconnects.
+func (cfg *apiConfig) newStreamReset(ctx context.Context) (stream.Event, error) {
+	latestID, err := cfg.db.GetLatestChirpEventID(ctx)
+	if err != nil {
+		return stream.Event{}, err
+	}
+	return stream.Event{
+		ID:   latestID,
+		Type: streamEventReset,
+		// Clients ignore events without data
+		Data: []byte(`{"reason":"replay_limit"}`),
+	}, nil
+}
+
+// streamFilter decides which events a subscriber gets.
+type streamFilter struct {
+	// authorID restricts the stream to one author unless it is uuid.Nil
+	authorID uuid.UUID
+	// hidden are the authors the viewer blocked or muted, or who blocked
+	// the viewer
+	hidden map[uuid.UUID]bool
+}
+
+func (f streamFilter) allows(authorID uuid.UUID) bool {
+	if f.authorID != uuid.Nil && authorID != f.authorID {
+		return false
+	}
+	return !f.hidden[authorID]
+}
+
+// handlerStream sends chirp events as Server-Sent Events. With an access
+// token, events of users hidden from the viewer the way GET /api/chirps
+// hides them are left out. Blocks and mutes are read when the stream
+// starts, changes apply once the client reconnects. A client reconnecting
+// too far behind gets a stream.reset event instead of what it missed.
+func (cfg *apiConfig) handlerStream(w http.ResponseWriter, r *http.Request) {
+	filter := streamFilter{hidden: map[uuid.UUID]bool{}}
+	if authorIDString := r.URL.Query().Get("author_id"); authorIDString != "" {
+		id, err := uuid.Parse(authorIDString)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid author_id", err)
+			return
+		}
+		filter.authorID = id
+	}
+
+	if viewerID, ok := cfg.bearerUser(r); ok {
+		hidden, err := cfg.db.GetHiddenAuthorIDs(r.Context(), viewerID)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get blocks and mutes", err)
+			return
+		}
+		for _, id := range hidden {
+			filter.hidden[id] = true
+		}
+	}
+
+	lastEventIDString := r.Header.Get("Last-Event-ID")
+	if lastEventIDString == "" {
+		lastEventIDString = r.URL.Query().Get("last_event_id")
+	}
+
+	// Subscribe before replaying so nothing published in between is lost,
+	// duplicates are skipped by the window of recently sent IDs
+	sub := cfg.stream.Subscribe()
+	defer cfg.stream.Unsubscribe(sub)
+
+	sent := stream.NewWindow(streamDedupWindow)
+	replay := []stream.Event{}
+	if lastEventIDString != "" {
+		lastEventID, err := strconv.ParseInt(lastEventIDString, 10, 64)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid last event id", err)
+			return
+		}
+
+		cursor := lastEventID
+		complete := false
+		for range streamMaxReplayPages {
+			events, err := cfg.db.GetChirpEventsAfter(r.Context(), cursor)
+			if err != nil {
+				respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get chirp events", err)
+				return
+			}
+
+			for _, event := range events {
+				cursor = event.ID
+				if !filter.allows(event.UserID) {
+					continue
+				}
+				streamEvent, err := newStreamEvent(event)
+				if err != nil {
+					respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to encode chirp event", err)
+					return
+				}
+				replay = append(replay, streamEvent)
+				sent.Add(event.ID)
+			}
+
+			if len(events) < chirpEventsPageSize {
+				complete = true
+				break
+			}
+		}
+
+		if !complete {
+			reset, err := cfg.newStreamReset(r.Context())
+			if err != nil {
+				respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get chirp events", err)
+				return
+			}
+			replay = []stream.Event{reset}
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		if err := stream.WriteEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if err := stream.WriteHeartbeat(w); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !filter.allows(event.AuthorID) {
+				continue
+			}
+			if !sent.Add(event.ID) {
+				continue
+			}
+			if err := stream.WriteEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestStreamFilterAllows(t *testing.T) {
+	author := uuid.New()
+	hidden := uuid.New()
+	other := uuid.New()
+
+	tests := []struct {
+		name     string
+		filter   streamFilter
+		authorID uuid.UUID
+		expected bool
+	}{
+		{
+			name:     "no filter",
+			filter:   streamFilter{},
+			authorID: other,
+			expected: true,
+		},
+		{
+			name:     "hidden author",
+			filter:   streamFilter{hidden: map[uuid.UUID]bool{hidden: true}},
+			authorID: hidden,
+			expected: false,
+		},
+		{
+			name:     "other author with hidden ones",
+			filter:   streamFilter{hidden: map[uuid.UUID]bool{hidden: true}},
+			authorID: other,
+			expected: true,
+		},
+		{
+			name:     "requested author",
+			filter:   streamFilter{authorID: author},
+			authorID: author,
+			expected: true,
+		},
+		{
+			name:     "not the requested author",
+			filter:   streamFilter{authorID: author},
+			authorID: other,
+			expected: false,
+		},
+		{
+			name:     "requested author is hidden",
+			filter:   streamFilter{authorID: hidden, hidden: map[uuid.UUID]bool{hidden: true}},
+			authorID: hidden,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.allows(tt.authorID); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStreamReplayHidesBlockedAndMuted(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, cfg, "viewer")
+	blocked := createTestUser(t, cfg, "blocked")
+	blocker := createTestUser(t, cfg, "blocker")
+	muted := createTestUser(t, cfg, "muted")
+	friend := createTestUser(t, cfg, "friend")
+
+	if _, err := cfg.db.BlockUser(ctx, database.BlockUserParams{BlockerID: viewer.ID, BlockedID: blocked.ID}); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+	if _, err := cfg.db.BlockUser(ctx, database.BlockUserParams{BlockerID: blocker.ID, BlockedID: viewer.ID}); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+	if _, err := cfg.db.MuteUser(ctx, database.MuteUserParams{MuterID: viewer.ID, MutedID: muted.ID}); err != nil {
+		t.Fatalf("failed to mute: %v", err)
+	}
+	for _, user := range []testUser{blocked, blocker, muted, friend} {
+		if _, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID}); err != nil {
+			t.Fatalf("failed to create chirp: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		user    *testUser
+		visible []testUser
+		hidden  []testUser
+	}{
+		{
+			name:    "anonymous",
+			user:    nil,
+			visible: []testUser{blocked, blocker, muted, friend},
+		},
+		{
+			name:    "viewer",
+			user:    &viewer,
+			visible: []testUser{friend},
+			hidden:  []testUser{blocked, blocker, muted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The stream only ends with its request
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			r := newTestRequest(t, "GET", "/api/stream", tt.user, nil).WithContext(ctx)
+			r.Header.Set("Last-Event-ID", "0")
+			rec := httptest.NewRecorder()
+			cfg.handlerStream(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+
+			body := rec.Body.String()
+			for _, user := range tt.visible {
+				if !strings.Contains(body, user.ID.String()) {
+					t.Errorf("expected a chirp by %s", user.Handle)
+				}
+			}
+			for _, user := range tt.hidden {
+				if strings.Contains(body, user.ID.String()) {
+					t.Errorf("expected no chirp by %s", user.Handle)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamReplayLimit(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := createTestUser(t, cfg, "prolific")
+
+	tests := []struct {
+		name      string
+		events    int
+		expectAll bool
+	}{
+		{name: "within the limit", events: 10, expectAll: true},
+		{name: "past the limit", events: streamMaxReplayPages*chirpEventsPageSize + 1, expectAll: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cfg.dbConn.Exec("DELETE FROM chirp_events"); err != nil {
+				t.Fatalf("failed to delete chirp events: %v", err)
+			}
+			_, err := cfg.dbConn.Exec(`INSERT INTO chirp_events (event, chirp_id, user_id, body, chirp_created_at, chirp_updated_at)
+				SELECT 'chirp.created', gen_random_uuid(), $1, 'hello', now(), now()
+				FROM generate_series(1, $2)`, author.ID, tt.events)
+			if err != nil {
+				t.Fatalf("failed to create chirp events: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			r := newTestRequest(t, "GET", "/api/stream", nil, nil).WithContext(ctx)
+			r.Header.Set("Last-Event-ID", "0")
+			rec := httptest.NewRecorder()
+			cfg.handlerStream(rec, r)
+
+			body := rec.Body.String()
+			created := strings.Count(body, "event: "+eventChirpCreated+"\n")
+			reset := strings.Contains(body, "event: "+streamEventReset+"\n")
+			if tt.expectAll && (created != tt.events || reset) {
+				t.Errorf("expected %d events and no reset, got %d events, reset %v", tt.events, created, reset)
+			}
+			if !tt.expectAll && (created != 0 || !reset) {
+				t.Errorf("expected only a reset, got %d events, reset %v", created, reset)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	planRed = "red"
+
+	subscriptionActive   = "active"
+	subscriptionCanceled = "canceled"
+	subscriptionRefunded = "refunded"
+
+	eventUserUpgraded          = "user.upgraded"
+	eventUserDowngraded        = "user.downgraded"
+	eventSubscriptionCancelled = "subscription.cancelled"
+	eventPaymentRefunded       = "payment.refunded"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+type subscriptionEvent struct {
+	Event       string
+	UserID      uuid.UUID
+	Plan        string
+	PeriodStart *time.Time
+	PeriodEnd   *time.Time
+}
+
+// applySubscriptionEvent moves the user's subscription to the state implied
+// by the event, records it in the subscription history and recomputes
+// is_chirpy_red. Unknown events and events for users without a subscription
+// are ignored.
+func applySubscriptionEvent(ctx context.Context, q *database.Queries, event subscriptionEvent, now time.Time) error {
+	var params database.UpsertSubscriptionParams
+
+	switch event.Event {
+	case eventUserUpgraded:
+		params = database.UpsertSubscriptionParams{
+			UserID:             event.UserID,
+			Plan:               planRed,
+			Status:             subscriptionActive,
+			CurrentPeriodStart: now,
+		}
+		if event.Plan != "" {
+			params.Plan = event.Plan
+		}
+		if event.PeriodStart != nil {
+			params.CurrentPeriodStart = *event.PeriodStart
+		}
+		if event.PeriodEnd != nil {
+			params.CurrentPeriodEnd = sql.NullTime{Time: *event.PeriodEnd, Valid: true}
+		}
+
+	case eventUserDowngraded, eventSubscriptionCancelled, eventPaymentRefunded:
+		current, err := q.GetSubscriptionByUser(ctx, event.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		status := subscriptionCanceled
+		if event.Event == eventPaymentRefunded {
+			status = subscriptionRefunded
+		}
+
+		params = database.UpsertSubscriptionParams{
+			UserID:             current.UserID,
+			Plan:               current.Plan,
+			Status:             status,
+			CurrentPeriodStart: current.CurrentPeriodStart,
+			CurrentPeriodEnd:   sql.NullTime{Time: now, Valid: true},
+		}
+
+	default:
+		return nil
+	}
+
+	subscription, err := q.UpsertSubscription(ctx, params)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return errUserNotFound
+		}
+		return err
+	}
+
+	err = q.CreateSubscriptionHistory(ctx, database.CreateSubscriptionHistoryParams{
+		SubscriptionID: subscription.ID,
+		Event:          event.Event,
+		Plan:           subscription.Plan,
+		Status:         subscription.Status,
+		PeriodStart:    subscription.CurrentPeriodStart,
+		PeriodEnd:      subscription.CurrentPeriodEnd,
+	})
+	if err != nil {
+		return err
+	}
+
+	return q.SyncChirpyRed(ctx, event.UserID)
+}
+
+// runSubscriptionExpiry periodically clears is_chirpy_red for users whose
+// subscription period has ended without a renewal event.
+func (cfg *apiConfig) runSubscriptionExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := cfg.db.ExpireChirpyRed(ctx)
+		if err != nil {
+			slog.Error("failed to expire subscriptions", "error", err)
+		} else if expired > 0 {
+			slog.Info("expired subscriptions", "count", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
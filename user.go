@@ -1,39 +1,65 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/Quak1/chirpy/internal/auth"
 	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/mail"
+	"github.com/Quak1/chirpy/internal/metrics"
 	"github.com/google/uuid"
 )
 
+const roleAdmin = "admin"
+
+// User is the private view of a user, only sent to the user themselves.
+// Profile is what everyone else sees.
 type User struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       string    `json:"email"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+}
+
+func newUser(user database.User) User {
+	return User{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   avatarURL(user.AvatarPath),
+	}
 }
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required,max=72"`
 	}
 
 	params := parameters{}
-	err := json.NewDecoder(r.Body).Decode(&params)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to parse request body", err)
+	if !cfg.decodeJSON(w, r, &params) {
 		return
 	}
 
+	_, span := tracer.Start(r.Context(), "auth.HashPassword")
 	hashedPassword, err := auth.HashPassword(params.Password)
+	span.End()
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to create user", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create user", err)
 		return
 	}
 
@@ -41,54 +67,79 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		Email:          params.Email,
 		HashedPassword: hashedPassword,
 	})
+	if isUniqueViolation(err) {
+		respondError(w, r, http.StatusConflict, codeConflict, "email is already in use", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to create user", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create user", err)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
+	respondJSON(w, http.StatusCreated, newUser(user))
 }
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	params := parameters{}
-	err := json.NewDecoder(r.Body).Decode(&params)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to parse request body", err)
+	if !cfg.decodeJSON(w, r, &params) {
 		return
 	}
 
 	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		metrics.Logins.WithLabelValues("failure").Inc()
+		respondError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "incorrect email or password", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusNotFound, "user not found", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to log in", err)
 		return
 	}
+	setRequestUser(r.Context(), user.ID)
 
+	_, span := tracer.Start(r.Context(), "auth.CheckPasswordHash")
 	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	span.End()
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "incorrect email or password", err)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		respondError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "incorrect email or password", err)
 		return
 	}
 
+	if restricted := restriction(user, time.Now()); restricted != nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
+		respondAccountRestricted(w, r, restricted)
+		return
+	}
+
+	// Logging in during the grace period keeps the account
+	if user.DeletedAt.Valid {
+		user, err = cfg.db.CancelUserDeletion(r.Context(), user.ID)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to log in", err)
+			return
+		}
+		loggerFrom(r.Context()).Info("account deletion cancelled by login")
+	}
+
+	_, span = tracer.Start(r.Context(), "auth.MakeJWT")
 	token, err := auth.MakeJWT(user.ID, cfg.tokenSecret, time.Hour)
+	span.End()
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "error making JWT", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create access token", err)
 		return
 	}
 
+	_, span = tracer.Start(r.Context(), "auth.MakeRefreshToken")
 	refreshToken, err := auth.MakeRefreshToken()
+	span.End()
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "error generating refresh token", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create refresh token", err)
 		return
 	}
 
@@ -98,22 +149,17 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		ExpiresAt: time.Now().Add(time.Hour * 24 * 60), // 60 days
 	})
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "error generating refresh token", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create refresh token", err)
 		return
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	respondJSON(w, http.StatusOK, struct {
 		User
 		Token        string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 	}{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         newUser(user),
 		Token:        token,
 		RefreshToken: refreshToken,
 	})
@@ -122,30 +168,40 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to get bearer token", err)
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing bearer token", err)
 		return
 	}
 
 	dbRefreshToken, err := cfg.db.GetRefreshToken(r.Context(), refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeInvalidToken, "invalid refresh token", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to get refresh token", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to refresh token", err)
 		return
 	}
+	setRequestUser(r.Context(), dbRefreshToken.UserID)
 
 	if dbRefreshToken.RevokedAt.Valid {
-		respondJSONError(w, http.StatusUnauthorized, "revoked token", err)
+		respondError(w, r, http.StatusUnauthorized, codeTokenRevoked, "refresh token has been revoked", err)
 		return
 	}
 
 	isExpired := dbRefreshToken.ExpiresAt.Before(time.Now())
 	if isExpired {
-		respondJSONError(w, http.StatusUnauthorized, "expired refresh token", err)
+		respondError(w, r, http.StatusUnauthorized, codeTokenExpired, "refresh token has expired", err)
+		return
+	}
+
+	if err := cfg.checkAccount(r.Context(), dbRefreshToken.UserID); err != nil {
+		respondAuthError(w, r, err)
 		return
 	}
 
 	jwtToken, err := auth.MakeJWT(dbRefreshToken.UserID, cfg.tokenSecret, time.Hour)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "error making JWT", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create access token", err)
 		return
 	}
 
@@ -159,98 +215,238 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to get bearer token", err)
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing bearer token", err)
 		return
 	}
 
 	err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to find refresh token", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to revoke refresh token", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
+// handlerUpdateMe applies a partial update to the authenticated user.
+// Changing the email or password requires the current password, profile
+// fields don't. A new email only takes effect once confirmed through a
+// token sent to it.
+func (cfg *apiConfig) handlerUpdateMe(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email           *string `json:"email" validate:"omitnil,email,max=254"`
+		Password        *string `json:"password" validate:"omitnil,min=1,max=72"`
+		CurrentPassword string  `json:"current_password" validate:"required_with=Email Password"`
+		Handle          *string `json:"handle" validate:"omitnil,handle"`
+		DisplayName     *string `json:"display_name" validate:"omitnil,max=50"`
+		Bio             *string `json:"bio" validate:"omitnil,max=160"`
+	}
+	type response struct {
+		User
+		PendingEmail string `json:"pending_email,omitempty"`
+	}
+
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to get bearer token", err)
+		respondAuthError(w, r, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "failed to validate JWT", err)
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
 		return
 	}
 
-	params := struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}{}
-	err = json.NewDecoder(r.Body).Decode(&params)
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusUnauthorized, codeUnauthorized, "user not found", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to parse request body", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get user", err)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if params.Email != nil || params.Password != nil {
+		_, span := tracer.Start(r.Context(), "auth.CheckPasswordHash")
+		err = auth.CheckPasswordHash(params.CurrentPassword, user.HashedPassword)
+		span.End()
+		if err != nil {
+			respondError(w, r, http.StatusForbidden, codeInvalidCredentials, "current password is incorrect", err)
+			return
+		}
+	}
+
+	tx, qtx, err := cfg.beginTx(r.Context())
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "failed to genereate hashed password", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
 		return
 	}
+	defer tx.Rollback()
 
-	updatedUser, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email:          params.Email,
-		ID:             userID,
-		HashedPassword: hashedPassword,
-		UpdatedAt:      time.Now(),
-	})
+	if params.Handle != nil || params.DisplayName != nil || params.Bio != nil {
+		user, err = qtx.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+			ID:          user.ID,
+			Handle:      nullString(params.Handle),
+			DisplayName: nullString(params.DisplayName),
+			Bio:         nullString(params.Bio),
+		})
+		if isUniqueViolation(err) {
+			respondError(w, r, http.StatusConflict, codeConflict, "handle is already taken", err)
+			return
+		}
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+	}
 
-	respondJSON(w, http.StatusOK, User{
-		ID:          updatedUser.ID,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
-	})
+	if params.Password != nil {
+		_, span := tracer.Start(r.Context(), "auth.HashPassword")
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		span.End()
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+
+		user, err = qtx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+
+		// Sessions started with the old password shouldn't outlive it
+		if _, err := qtx.RevokeUserRefreshTokens(r.Context(), user.ID); err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+	}
+
+	var confirmation string
+	if params.Email != nil && *params.Email != user.Email {
+		_, err := qtx.GetUserByEmail(r.Context(), *params.Email)
+		if err == nil {
+			respondError(w, r, http.StatusConflict, codeConflict, "email is already in use", nil)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+
+		// Only the latest requested change can be confirmed
+		if err := qtx.DeleteUserEmailChanges(r.Context(), user.ID); err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+
+		token, hash := auth.MakeConfirmationToken()
+		_, err = qtx.CreateEmailChange(r.Context(), database.CreateEmailChangeParams{
+			TokenHash: hash,
+			UserID:    user.ID,
+			NewEmail:  *params.Email,
+			ExpiresAt: time.Now().Add(emailChangeTTL),
+		})
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+			return
+		}
+		confirmation = token
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to update user", err)
+		return
+	}
+
+	res := response{User: newUser(user)}
+	if confirmation != "" {
+		err := cfg.mailer.Send(r.Context(), mail.Message{
+			To:      *params.Email,
+			Subject: "Confirm your new Chirpy email address",
+			Body:    fmt.Sprintf(emailChangeMessage, confirmation, emailChangeTTL),
+		})
+		// The other changes are committed, failing now would have clients
+		// retry them. Asking for the change again sends a new email.
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to send confirmation email", "error", err)
+		}
+		res.PendingEmail = *params.Email
+	}
+
+	respondJSON(w, http.StatusOK, res)
 }
 
-func (cfg *apiConfig) handlerUpgradeToChirpyRed(w http.ResponseWriter, r *http.Request) {
-	apiKey, err := auth.GetApiKey(r.Header)
+const emailChangeTTL = 24 * time.Hour
+
+const emailChangeMessage = `Someone asked to change the email address of a Chirpy account to this address.
+
+To confirm the change, send this token to POST /api/users/confirm-email:
+
+%s
+
+The token expires in %s. If you didn't ask for this, ignore this email and nothing will change.
+`
+
+// handlerConfirmEmail applies a pending email change. The token proves
+// the user controls the new address, so no access token is needed.
+func (cfg *apiConfig) handlerConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	change, err := cfg.db.GetEmailChange(r.Context(), auth.HashToken(params.Token))
+	if err == nil && change.ExpiresAt.Before(time.Now()) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusBadRequest, codeInvalidToken, "invalid or expired confirmation token", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "missing API key", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to confirm email", err)
 		return
 	}
+	setRequestUser(r.Context(), change.UserID)
 
-	if apiKey != cfg.polkaKey {
-		respondJSONError(w, http.StatusUnauthorized, "wrong API key", err)
+	tx, qtx, err := cfg.beginTx(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to confirm email", err)
 		return
 	}
+	defer tx.Rollback()
 
-	params := struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
-	}{}
-	err = json.NewDecoder(r.Body).Decode(&params)
+	user, err := qtx.SetUserEmail(r.Context(), database.SetUserEmailParams{
+		ID:    change.UserID,
+		Email: change.NewEmail,
+	})
+	if isUniqueViolation(err) {
+		respondError(w, r, http.StatusConflict, codeConflict, "email is already in use", err)
+		return
+	}
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "failed to parse request body", err)
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to confirm email", err)
 		return
 	}
 
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
+	if err := qtx.DeleteUserEmailChanges(r.Context(), user.ID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to confirm email", err)
 		return
 	}
 
-	err = cfg.db.UpgradeChirpyRed(r.Context(), params.Data.UserID)
-	if err != nil {
-		respondJSONError(w, http.StatusNotFound, "user not found", err)
+	if err := tx.Commit(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to confirm email", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	respondJSON(w, http.StatusOK, newUser(user))
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateMeEmailNotSent(t *testing.T) {
+	cfg := newTestConfig(t)
+	sender := &recordingSender{err: errors.New("smtp server unavailable")}
+	cfg.mailer = sender
+	user := createTestUser(t, cfg, "mover")
+
+	var res struct {
+		User
+		PendingEmail string `json:"pending_email"`
+	}
+	r := newTestRequest(t, "PATCH", "/api/users/me", &user, map[string]any{
+		"email":            "new@example.com",
+		"current_password": testPassword,
+		"bio":              "moved",
+	})
+	serveTest(t, cfg.handlerUpdateMe, r, http.StatusOK, &res)
+
+	if res.PendingEmail != "new@example.com" {
+		t.Errorf("expected pending email new@example.com, got %q", res.PendingEmail)
+	}
+	if res.Bio != "moved" {
+		t.Errorf("expected bio to be updated, got %q", res.Bio)
+	}
+
+	sender.err = nil
+	r = newTestRequest(t, "PATCH", "/api/users/me", &user, map[string]any{
+		"email":            "new@example.com",
+		"current_password": testPassword,
+	})
+	serveTest(t, cfg.handlerUpdateMe, r, http.StatusOK, nil)
+	if len(sender.messages) != 1 {
+		t.Errorf("expected the email to be sent when asked again, got %d messages", len(sender.messages))
+	}
+}
@@ -5,8 +5,13 @@ import (
 	"strings"
 )
 
-func validateChirp(body string) (string, error) {
-	if len(body) > 140 {
+const (
+	maxChirpLength     = 140
+	maxLongChirpLength = 1000
+)
+
+func validateChirp(body string, maxLength int) (string, error) {
+	if len(body) > maxLength {
 		return "", fmt.Errorf("Chirp is too long")
 	}
 
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Quak1/chirpy/internal/database"
+	"github.com/Quak1/chirpy/internal/tracing"
+	"github.com/Quak1/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpUpdated = "chirp.updated"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserFollowed = "user.followed"
+
+	webhookBatchSize   = 50
+	webhookSendTimeout = 10 * time.Second
+	// webhookLease is how long claimed deliveries are left to a dispatcher
+	// before another one may retry them. It outlasts a batch where every
+	// endpoint times out, so slow endpoints don't get sent twice.
+	webhookLease = webhookBatchSize*webhookSendTimeout + time.Minute
+)
+
+var webhookEvents = []string{
+	eventChirpCreated,
+	eventChirpUpdated,
+	eventChirpDeleted,
+	eventUserFollowed,
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID                `json:"id"`
+	CreatedAt      time.Time                `json:"created_at"`
+	Event          string                   `json:"event"`
+	Payload        json.RawMessage          `json:"payload"`
+	Status         string                   `json:"status"`
+	Attempts       int32                    `json:"attempts"`
+	NextAttemptAt  time.Time                `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time               `json:"last_attempt_at"`
+	ResponseStatus *int32                   `json:"response_status"`
+	LastError      string                   `json:"last_error,omitempty"`
+	Log            []WebhookDeliveryAttempt `json:"log,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	AttemptedAt    time.Time `json:"attempted_at"`
+	ResponseStatus *int32    `json:"response_status"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int32     `json:"duration_ms"`
+}
+
+func newWebhookEndpoint(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        endpoint.ID,
+		CreatedAt: endpoint.CreatedAt,
+		UpdatedAt: endpoint.UpdatedAt,
+		URL:       endpoint.Url,
+		Events:    endpoint.Events,
+		Active:    endpoint.Active,
+	}
+}
+
+func newWebhookDelivery(delivery database.WebhookDelivery) WebhookDelivery {
+	res := WebhookDelivery{
+		ID:            delivery.ID,
+		CreatedAt:     delivery.CreatedAt,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		LastError:     delivery.LastError.String,
+	}
+	if delivery.LastAttemptAt.Valid {
+		res.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.ResponseStatus.Valid {
+		res.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	return res
+}
+
+// enqueueEvent queues a delivery of the event for every active endpoint
+// of userID subscribed to it. Events only go to the user they are about,
+// the author of a chirp or the user being followed. Pass the Queries of
+// the transaction that made the change so the event is only sent if the
+// change is committed.
+func enqueueEvent(ctx context.Context, q *database.Queries, userID uuid.UUID, event string, data any) error {
+	payload, err := json.Marshal(struct {
+		Event     string    `json:"event"`
+		CreatedAt time.Time `json:"created_at"`
+		Data      any       `json:"data"`
+	}{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		Event:   event,
+		Payload: string(payload),
+		UserID:  userID,
+	})
+	return err
+}
+
+func (cfg *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL    string   `json:"url" validate:"required,http_url"`
+		Events []string `json:"events" validate:"required,min=1,dive,webhook_event"`
+	}
+
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+	if !cfg.decodeJSON(w, r, &params) {
+		return
+	}
+
+	err = webhook.CheckURL(r.Context(), net.DefaultResolver, params.URL)
+	if errors.Is(err, webhook.ErrNonPublicAddress) {
+		respondValidationError(w, r, fieldError{Field: "url", Code: "public_host", Message: "must not point to a private or internal address"})
+		return
+	}
+	if err != nil {
+		respondValidationError(w, r, fieldError{Field: "url", Code: "unresolvable_host", Message: "host could not be resolved"})
+		return
+	}
+
+	secret := webhook.NewSecret()
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID: userID,
+		Url:    params.URL,
+		Secret: secret,
+		Events: params.Events,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to create webhook", err)
+		return
+	}
+
+	// The secret is only shown once, when the endpoint is created
+	res := newWebhookEndpoint(endpoint)
+	res.Secret = secret
+	respondJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) handlerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	endpoints, err := cfg.db.GetUserWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get webhooks", err)
+		return
+	}
+
+	res := make([]WebhookEndpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		res[i] = newWebhookEndpoint(endpoint)
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.getOwnedWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteWebhookEndpoint(r.Context(), endpoint.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to delete webhook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.getOwnedWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := cfg.db.GetEndpointWebhookDeliveries(r.Context(), endpoint.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get deliveries", err)
+		return
+	}
+
+	res := make([]WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		res[i] = newWebhookDelivery(delivery)
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := cfg.getOwnedWebhookDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	attempts, err := cfg.db.GetWebhookDeliveryAttempts(r.Context(), delivery.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to get delivery log", err)
+		return
+	}
+
+	res := newWebhookDelivery(delivery)
+	res.Log = make([]WebhookDeliveryAttempt, len(attempts))
+	for i, attempt := range attempts {
+		res.Log[i] = WebhookDeliveryAttempt{
+			AttemptedAt: attempt.AttemptedAt,
+			Error:       attempt.Error.String,
+			DurationMs:  attempt.DurationMs,
+		}
+		if attempt.ResponseStatus.Valid {
+			res.Log[i].ResponseStatus = &attempt.ResponseStatus.Int32
+		}
+	}
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := cfg.getOwnedWebhookDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := cfg.db.ResetWebhookDelivery(r.Context(), delivery.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, codeInternal, "failed to schedule redelivery", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, newWebhookDelivery(delivery))
+}
+
+// getOwnedWebhookEndpoint loads the endpoint from the webhookID path value
+// and checks that it belongs to the authenticated user. It writes the error
+// response itself and reports whether the handler should continue.
+func (cfg *apiConfig) getOwnedWebhookEndpoint(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid webhook id", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), endpointID)
+	if err == nil && endpoint.UserID != userID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondLookupError(w, r, "webhook", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	return endpoint, true
+}
+
+func (cfg *apiConfig) getOwnedWebhookDelivery(w http.ResponseWriter, r *http.Request) (database.WebhookDelivery, bool) {
+	endpoint, ok := cfg.getOwnedWebhookEndpoint(w, r)
+	if !ok {
+		return database.WebhookDelivery{}, false
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidID, "invalid delivery id", err)
+		return database.WebhookDelivery{}, false
+	}
+
+	delivery, err := cfg.db.GetWebhookDelivery(r.Context(), deliveryID)
+	if err == nil && delivery.EndpointID != endpoint.ID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondLookupError(w, r, "delivery", err)
+		return database.WebhookDelivery{}, false
+	}
+
+	return delivery, true
+}
+
+// runWebhookDispatcher polls the delivery queue until ctx is cancelled.
+// Deliveries are claimed with SKIP LOCKED so several server instances can
+// run a dispatcher against the same database. The client only connects to
+// public addresses, endpoint hosts may have been pointed inside the
+// network since they were registered.
+func (cfg *apiConfig) runWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	client := &http.Client{
+		Transport: tracing.Transport(webhook.Transport()),
+		Timeout:   webhookSendTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.dispatchWebhooks(ctx, client)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) dispatchWebhooks(ctx context.Context, client *http.Client) {
+	deliveries, err := cfg.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseSeconds: webhookLease.Seconds(),
+		BatchSize:    webhookBatchSize,
+	})
+	if err != nil {
+		slog.Error("failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		// Claimed but unsent deliveries are retried once their lease expires
+		if ctx.Err() != nil {
+			return
+		}
+
+		endpoint, err := cfg.db.GetWebhookEndpoint(ctx, delivery.EndpointID)
+		if err != nil {
+			slog.Error("failed to get webhook endpoint", "endpoint_id", delivery.EndpointID, "error", err)
+			continue
+		}
+
+		start := time.Now()
+		statusCode, sendErr := webhook.Send(ctx, client, webhook.Delivery{
+			ID:      delivery.ID.String(),
+			Event:   delivery.Event,
+			URL:     endpoint.Url,
+			Secret:  []byte(endpoint.Secret),
+			Payload: delivery.Payload,
+		})
+		duration := time.Since(start)
+
+		responseStatus := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+		lastError := sql.NullString{}
+		if sendErr != nil {
+			lastError = sql.NullString{String: sendErr.Error(), Valid: true}
+		}
+
+		err = cfg.db.CreateWebhookDeliveryAttempt(ctx, database.CreateWebhookDeliveryAttemptParams{
+			DeliveryID:     delivery.ID,
+			ResponseStatus: responseStatus,
+			Error:          lastError,
+			DurationMs:     int32(duration.Milliseconds()),
+		})
+		if err != nil {
+			slog.Error("failed to record webhook attempt", "delivery_id", delivery.ID, "error", err)
+		}
+
+		attempts := int(delivery.Attempts) + 1
+		status := "succeeded"
+		nextAttemptAt := delivery.NextAttemptAt
+		if sendErr != nil {
+			status = "pending"
+			nextAttemptAt = time.Now().Add(webhook.Backoff(attempts))
+			if attempts >= webhook.MaxAttempts {
+				status = "failed"
+			}
+		}
+
+		err = cfg.db.UpdateWebhookDeliveryAttempt(ctx, database.UpdateWebhookDeliveryAttemptParams{
+			ID:             delivery.ID,
+			Status:         status,
+			NextAttemptAt:  nextAttemptAt,
+			ResponseStatus: responseStatus,
+			LastError:      lastError,
+		})
+		if err != nil {
+			slog.Error("failed to update webhook delivery", "delivery_id", delivery.ID, "error", err)
+		}
+	}
+}